@@ -1,12 +1,22 @@
 package app
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"mime"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Cozzytree/apihub/config"
 	"github.com/Cozzytree/apihub/interfaces"
@@ -21,18 +31,73 @@ func (r RuleHeaderNotMatched) Error() string {
 }
 
 type matcher struct {
+	// maxBody caps how much of a request body is buffered for body
+	// matchers, 0 means defaultMaxBody
+	maxBody int64
 }
 
-func (m *matcher) findMatchingRule(request *http.Request, rules []config.Rule) (*config.Rule, error) {
+const defaultMaxBody = 10 << 20
+
+// requestBody reads a request body the first time a rule needs it and puts
+// it back so the body can still be forwarded by proxy rules.
+type requestBody struct {
+	data []byte
+	err  error
+	read bool
+}
+
+func (m *matcher) body(r *http.Request, b *requestBody) ([]byte, error) {
+	if b.read {
+		return b.data, b.err
+	}
+	b.read = true
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	limit := m.maxBody
+	if limit <= 0 {
+		limit = defaultMaxBody
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	// the unread rest, if any, follows the buffered part
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	switch {
+	case err != nil:
+		b.err = err
+	case int64(len(data)) > limit:
+		b.err = fmt.Errorf("body larger than %d bytes", limit)
+	default:
+		b.data = data
+	}
+	return b.data, b.err
+}
+
+// match is a rule matched against one request, with the path params and
+// query values captured from it.
+type match struct {
+	rule   *config.Rule
+	params map[string]string
+}
+
+// matchKey holds the match limitRequests found in the request context, so
+// handleRequest doesn't match the request again.
+type matchKey struct{}
+
+func (m *matcher) findMatchingRule(request *http.Request, rules []config.Rule) (*match, error) {
 	var errs []error
+	var body requestBody
 
-	for _, r := range rules {
-		if ok, err := m.doesRuleMatch(request, &r); ok {
+	for i := range rules {
+		r := &rules[i]
+		if params, err := m.doesRuleMatch(request, r, &body); err == nil {
 			// Found a matching rule, return immediately
-			return &r, nil
-		} else if err != nil {
+			return &match{rule: r, params: params}, nil
+		} else {
 			// Collect errors for debugging/logging
-			errs = append(errs, fmt.Errorf("rule %q: %w", r.Request.Path, err))
+			errs = append(errs, fmt.Errorf("rule %q: %w", r.Label(), err))
 		}
 	}
 
@@ -49,20 +114,44 @@ func (m *matcher) findMatchingRule(request *http.Request, rules []config.Rule) (
 	return nil, errors.New("no rules configured")
 }
 
-func (m *matcher) doesRuleMatch(request *http.Request, rule *config.Rule) (bool, error) {
+// doesRuleMatch returns the captured params when the rule matches.
+func (m *matcher) doesRuleMatch(request *http.Request, rule *config.Rule, body *requestBody) (map[string]string, error) {
 	if !m.matchMethod(request, rule) {
-		return false, errors.New("Method not matched")
+		return nil, errors.New("Method not matched")
+	}
+
+	if rule.Request.Host != "" && !config.MatchHost(rule.Request.Host, request.Host) {
+		return nil, errors.New("Host not matched")
 	}
 
-	if !m.matchPath(request, rule) {
-		return false, errors.New("Path not matched")
+	params, ok := m.matchPath(request, rule)
+	if !ok {
+		return nil, errors.New("Path not matched")
 	}
 
 	if !m.matchHeaders(request, rule) {
-		return false, RuleHeaderNotMatched{}
+		return nil, RuleHeaderNotMatched{}
+	}
+
+	if !m.matchQuery(request, rule, params) {
+		return nil, errors.New("Query not matched")
+	}
+
+	if !m.matchCookies(request, rule) {
+		return nil, errors.New("Cookies not matched")
+	}
+
+	if b := rule.Request.Body; b != nil {
+		data, err := m.body(request, body)
+		if err != nil {
+			return nil, fmt.Errorf("Body not read: %w", err)
+		}
+		if !b.Match(data, request.Header.Get("Content-Type")) {
+			return nil, errors.New("Body not matched")
+		}
 	}
 
-	return true, nil
+	return params, nil
 }
 
 func (m matcher) matchMethod(request *http.Request, rule *config.Rule) bool {
@@ -73,54 +162,92 @@ func (m matcher) matchMethod(request *http.Request, rule *config.Rule) bool {
 	return false
 }
 
-func (m matcher) matchPath(request *http.Request, rule *config.Rule) bool {
-	reqPath := strings.TrimSuffix(request.URL.Path, "/")
-	rulePath := strings.TrimSuffix(rule.Request.Path, "/")
-
-	reqParts := strings.Split(reqPath, "/")
-	ruleParts := strings.Split(rulePath, "/")
+func (m matcher) matchPath(request *http.Request, rule *config.Rule) (map[string]string, bool) {
+	return config.MatchPath(rule.Request.Path, request.URL.EscapedPath())
+}
 
-	if len(reqParts) != len(ruleParts) {
-		return false
+// matchQuery checks the query matchers and adds the first value of every
+// matched parameter to params, escaped for use in a url, unless a path
+// param has the same name.
+func (m matcher) matchQuery(r *http.Request, rule *config.Rule, params map[string]string) bool {
+	if len(rule.Request.Query) == 0 {
+		return true
 	}
-
-	for i := range ruleParts {
-		rp := ruleParts[i]
-		rq := reqParts[i]
-
-		if strings.HasPrefix(rp, ":") {
-			continue
-		}
-
-		if rq != rp {
+	query := r.URL.Query()
+	for name, matcher := range rule.Request.Query {
+		values, present := query[name]
+		if !matcher.Match(values, present) {
 			return false
 		}
 	}
-
-	rule.Request.Params = extractParams(rulePath, reqPath)
+	for name := range rule.Request.Query {
+		if _, ok := params[name]; !ok && query.Has(name) {
+			params[name] = url.PathEscape(query.Get(name))
+		}
+	}
 	return true
 }
 
 func (m matcher) matchHeaders(r *http.Request, rule *config.Rule) bool {
-	for key, rule_header := range rule.Request.Headers {
-		h := r.Header.Get(key)
-		if h == "" {
+	for name, matcher := range rule.Request.Headers {
+		values, present := headerValues(r, name)
+		if !matcher.Match(values, present) {
 			return false
 		}
-		if rule_header != h {
+	}
+	return true
+}
+
+func (m matcher) matchCookies(r *http.Request, rule *config.Rule) bool {
+	for name, matcher := range rule.Request.Cookies {
+		var values []string
+		for _, c := range r.CookiesNamed(name) {
+			values = append(values, c.Value)
+		}
+		if !matcher.Match(values, len(values) > 0) {
 			return false
 		}
 	}
 	return true
 }
 
+// headerValues returns every value of a header. A header line holding a
+// comma separated list counts both as a whole and as its items, so
+// Accept: a, b matches a, b and "a, b".
+func headerValues(r *http.Request, name string) ([]string, bool) {
+	lines := r.Header.Values(name)
+	// net/http moves Host out of the header map
+	if http.CanonicalHeaderKey(name) == "Host" && r.Host != "" {
+		lines = []string{r.Host}
+	}
+	if len(lines) == 0 {
+		return nil, false
+	}
+	values := slices.Clone(lines)
+	for _, line := range lines {
+		if !strings.Contains(line, ",") {
+			continue
+		}
+		for item := range strings.SplitSeq(line, ",") {
+			values = append(values, strings.TrimSpace(item))
+		}
+	}
+	return values, true
+}
+
 type Api struct {
 	server  interfaces.Server
 	config  config.Config
 	matcher *matcher
+	// limiter is the server-wide rate limiter, groups with their own
+	// rate_limit settings use groupLimiters instead
+	limiter       *middleware.RateLimiter
+	groupLimiters map[*config.Group]*middleware.RateLimiter
 }
 
 func Init(srv interfaces.Server, app_config config.Config) Api {
+	app_config.Rules = slices.Clone(app_config.Rules)
+	config.SortRules(app_config.Rules)
 	return Api{
 		server:  srv,
 		config:  app_config,
@@ -130,7 +257,7 @@ func Init(srv interfaces.Server, app_config config.Config) Api {
 
 func (a *Api) Start(server_config interfaces.ServerConfig) error {
 	for _, rule := range a.config.Rules {
-		a.server.AddRoute(rule.Request.Method, rule.Request.Path, a.handleRequest)
+		a.server.AddRoute(rule.Request.Method, rule.Request.Host, rule.Request.Path, a.handleRequest)
 	}
 	// a.server.AddRoute(http.MethodGet, "/*", a.handleRequest)
 	// a.server.AddRoute(interfaces.POST, "/*", a.handleRequest)
@@ -141,14 +268,35 @@ func (a *Api) Start(server_config interfaces.ServerConfig) error {
 	// a.server.AddRoute(interfaces.OPTIONS, "/*", a.handleRequest)
 
 	a.server.AddMiddleware(middleware.Logger)
+	a.matcher.maxBody = int64(server_config.Max_request_size)
 
-	// rate limiter
 	if server_config.Rate_limit {
-		limiter := middleware.NewRateLimiter(
+		a.limiter = middleware.NewRateLimiter(
 			server_config.Rate_limit_window_ms,
 			uint(server_config.Rate_limit_requests),
 		)
-		a.server.AddMiddleware(limiter.RateLimitMiddleware)
+	}
+	a.groupLimiters = make(map[*config.Group]*middleware.RateLimiter)
+	for _, rule := range a.config.Rules {
+		g := rule.Group
+		if g == nil || g.RateLimit == nil || !g.RateLimit.IsEnabled() {
+			continue
+		}
+		if _, ok := a.groupLimiters[g]; ok {
+			continue
+		}
+		window := server_config.Rate_limit_window_ms
+		if g.RateLimit.Window != 0 {
+			window = time.Duration(g.RateLimit.Window)
+		}
+		requests := server_config.Rate_limit_requests
+		if g.RateLimit.Requests != 0 {
+			requests = g.RateLimit.Requests
+		}
+		a.groupLimiters[g] = middleware.NewRateLimiter(window, uint(requests))
+	}
+	if a.limiter != nil || len(a.groupLimiters) > 0 {
+		a.server.AddMiddleware(a.limitRequests)
 	}
 
 	return a.server.Start(server_config)
@@ -158,29 +306,91 @@ func (a *Api) Stop() {
 	a.server.Stop()
 }
 
+// limitRequests applies the rate limits before routing, so requests that
+// match no rule count against the server-wide limit too.
+func (a *Api) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rule *config.Rule
+		if matched, _ := a.matcher.findMatchingRule(r, a.config.Rules); matched != nil {
+			rule = matched.rule
+			r = r.WithContext(context.WithValue(r.Context(), matchKey{}, matched))
+		}
+		if limiter := a.limiterFor(rule); limiter != nil && !limiter.Allow(r) {
+			http.Error(w, "429 - Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (a *Api) handleRequest(w http.ResponseWriter, r *http.Request) {
-	matching_rule, err := a.matcher.findMatchingRule(r, a.config.Rules)
-	if matching_rule == nil {
+	matched, ok := r.Context().Value(matchKey{}).(*match)
+	var err error
+	if !ok {
+		matched, err = a.matcher.findMatchingRule(r, a.config.Rules)
+	}
+	if matched == nil {
 		fmt.Printf("No matching rule found for Method: %s, Path: %s, err: %v\n", r.Method, r.URL.Path, err)
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("No matching rule found"))
 		return
 	}
+	matching_rule := matched.rule
+
+	if g := matching_rule.Group; g != nil && g.Auth != nil && !authorized(r, g.Auth) {
+		if len(g.Auth.Basic) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="apihub"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, "401 - Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	if matching_rule.IsMock() {
-		a.serveMockRequest(w, matching_rule)
+		a.serveMockRequest(w, r, matching_rule)
 		return
 	}
 
 	if matching_rule.IsProxy() {
-		a.serveProxyRequest(w, r, matching_rule)
+		a.serveProxyRequest(w, r, matching_rule, matched.params)
 		return
 	}
 }
 
-func (a *Api) serveMockRequest(w http.ResponseWriter, rule *config.Rule) {
+// limiterFor returns the rate limiter that applies to rule, nil when
+// requests are not limited. Requests without a rule use the server-wide
+// limiter.
+func (a *Api) limiterFor(rule *config.Rule) *middleware.RateLimiter {
+	if rule == nil {
+		return a.limiter
+	}
+	if g := rule.Group; g != nil && g.RateLimit != nil {
+		return a.groupLimiters[g]
+	}
+	return a.limiter
+}
+
+// authorized reports whether the request carries one of the credentials in
+// auth.
+func authorized(r *http.Request, auth *config.AuthSettings) bool {
+	if user, pass, ok := r.BasicAuth(); ok {
+		if want, ok := auth.Basic[user]; ok && subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1 {
+			return true
+		}
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, want := range auth.Bearer {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Api) serveMockRequest(w http.ResponseWriter, r *http.Request, rule *config.Rule) {
 	response := rule.Response
-	w.WriteHeader(int(response.Status))
 	for key, val := range response.Headers {
 		if strVal, ok := val.(string); ok {
 			w.Header().Set(key, strVal)
@@ -189,15 +399,68 @@ func (a *Api) serveMockRequest(w http.ResponseWriter, rule *config.Rule) {
 			w.Header().Set(key, fmt.Sprintf("%v", val))
 		}
 	}
-	w.Write([]byte(response.Body))
+
+	if response.BodyFile != "" {
+		a.serveBodyFile(w, r, rule)
+		return
+	}
+
+	w.WriteHeader(mockStatus(response))
+	w.Write([]byte(response.Body.Text))
 }
 
-func (a *Api) serveProxyRequest(w http.ResponseWriter, r *http.Request, rule *config.Rule) {
+// mockStatus returns the status of a mock response, 200 when it sets none.
+func mockStatus(response *config.MockResponse) int {
+	if response.Status == 0 {
+		return http.StatusOK
+	}
+	return int(response.Status)
+}
+
+// serveBodyFile streams the body from disk. 200 responses go through
+// http.ServeContent so Range and conditional requests work.
+func (a *Api) serveBodyFile(w http.ResponseWriter, r *http.Request, rule *config.Rule) {
+	response := rule.Response
+	file, err := a.config.Open(response.BodyFile)
+	if err != nil {
+		fmt.Printf("rule %q: error opening body file: %v\n", rule.Label(), err)
+		http.Error(w, "body file not available", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, "body file not available", http.StatusInternalServerError)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		if ctype := mime.TypeByExtension(filepath.Ext(response.BodyFile)); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+	}
+
+	status := mockStatus(response)
+	// files from an fs.FS aren't always seekable
+	if seeker, ok := file.(io.ReadSeeker); ok && status == http.StatusOK {
+		http.ServeContent(w, r, stat.Name(), stat.ModTime(), seeker)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, file); err != nil {
+		fmt.Printf("rule %q: error copying body file: %v\n", rule.Label(), err)
+	}
+}
+
+func (a *Api) serveProxyRequest(w http.ResponseWriter, r *http.Request, rule *config.Rule, params map[string]string) {
 	target := rule.Proxy.Url
 
-	// Replace path parameters
-	if !rule.IsProxyStatic() && len(rule.Request.Params) > 0 {
-		target = substituteProxyParams(target, rule.Request.Params)
+	// Replace path parameters and matched query values
+	if len(params) > 0 {
+		target = substituteProxyParams(target, params)
 	}
 
 	proxyUrl, err := url.Parse(target)
@@ -205,12 +468,22 @@ func (a *Api) serveProxyRequest(w http.ResponseWriter, r *http.Request, rule *co
 		http.Error(w, fmt.Sprintf("invalid proxy target: %v", err), http.StatusBadGateway)
 		return
 	}
+	// forward the query string after the one in the target url
+	if r.URL.RawQuery != "" {
+		if proxyUrl.RawQuery != "" {
+			proxyUrl.RawQuery += "&"
+		}
+		proxyUrl.RawQuery += r.URL.RawQuery
+	}
 
 	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, proxyUrl.String(), r.Body)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create proxy request: %v", err), http.StatusInternalServerError)
 		return
 	}
+	// the body may have been buffered by a body matcher, which hides its
+	// length from NewRequest
+	proxyReq.ContentLength = r.ContentLength
 	proxyReq.Header = make(http.Header)
 	for key, values := range r.Header {
 		for _, v := range values {
@@ -227,6 +500,7 @@ func (a *Api) serveProxyRequest(w http.ResponseWriter, r *http.Request, rule *co
 
 	res, err := client.Do(proxyReq)
 	if err != nil {
+		fmt.Printf("rule %q: proxy error: %v\n", rule.Label(), err)
 		http.Error(w, fmt.Sprintf("proxy error: %v", err), http.StatusBadGateway)
 		return
 	}
@@ -241,27 +515,23 @@ func (a *Api) serveProxyRequest(w http.ResponseWriter, r *http.Request, rule *co
 	}
 
 	if _, err := io.Copy(w, res.Body); err != nil {
-		fmt.Printf("error copying proxy response: %v\n", err)
+		fmt.Printf("rule %q: error copying proxy response: %v\n", rule.Label(), err)
 	}
 }
 
+// substituteProxyParams replaces :name and ** in a proxy url with the
+// captured params, which are already escaped. Longer names go first so :id
+// doesn't eat into :idx.
 func substituteProxyParams(template string, params map[string]string) string {
-	for key, val := range params {
-		placeholder := ":" + key
-		template = strings.ReplaceAll(template, placeholder, val)
-	}
-	return template
-}
-
-func extractParams(rulePath, reqPath string) map[string]string {
-	ruleParts := strings.Split(strings.Trim(rulePath, "/"), "/")
-	reqParts := strings.Split(strings.Trim(reqPath, "/"), "/")
-	params := make(map[string]string)
-
-	for i, rulePart := range ruleParts {
-		if strings.HasPrefix(rulePart, ":") && i < len(reqParts) {
-			params[rulePart[1:]] = reqParts[i]
+	names := slices.SortedFunc(maps.Keys(params), func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	for _, name := range names {
+		placeholder := ":" + name
+		if name == config.CatchAll {
+			placeholder = name
 		}
+		template = strings.ReplaceAll(template, placeholder, params[name])
 	}
-	return params
+	return template
 }
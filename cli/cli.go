@@ -1,16 +1,23 @@
 package cli
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Cozzytree/apihub/app"
 	"github.com/Cozzytree/apihub/config"
+	"github.com/Cozzytree/apihub/exporter"
 	httpserver "github.com/Cozzytree/apihub/http_server"
+	"github.com/Cozzytree/apihub/importer"
 	"github.com/Cozzytree/apihub/interfaces"
 	"github.com/fsnotify/fsnotify"
 )
@@ -26,6 +33,11 @@ type ServeConfig struct {
 	max_request_size uint
 	request_timeout  time.Duration
 	rate_limiter     bool
+	strict           bool
+	lenient          bool
+	openapi          string
+	tags             []string
+	profile          string
 }
 
 type CLI struct {
@@ -46,7 +58,24 @@ func (c *CLI) Run(args []string) error {
 	case "serve":
 		c.runServeCmd(args[1:])
 	case "validate":
-
+		return c.runValidateCmd(args[1:])
+	case "import":
+		return c.runImportCmd(args[1:])
+	case "export":
+		return c.runExportCmd(args[1:])
+	case "convert":
+		return c.runConvertCmd(args[1:])
+	case "init":
+		return c.runInitCmd(args[1:])
+	case "fmt":
+		return c.runFmtCmd(args[1:])
+	case "schema":
+		data, err := config.SchemaJSON()
+		if err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+		fmt.Println(string(data))
 	case "version":
 		fmt.Println(version)
 	case "-h", "--help":
@@ -93,6 +122,12 @@ func (c *CLI) runServeCmd(args []string) {
 		case "-rl":
 			serve_conf.rate_limiter = true
 			i += 1
+		case "--strict":
+			serve_conf.strict = true
+			i += 1
+		case "--lenient":
+			serve_conf.lenient = true
+			i += 1
 		case "--request-timeout":
 			if i+1 >= uint(len(args)) {
 				fmt.Println("--max-request-size requires a value")
@@ -118,6 +153,31 @@ func (c *CLI) runServeCmd(args []string) {
 			}
 			serve_conf.max_request_size = uint(max_req)
 			i += 2
+		case "--profile":
+			if i+1 >= uint(len(args)) {
+				fmt.Println("--profile requires a value")
+				os.Exit(1)
+			}
+			serve_conf.profile = args[i+1]
+			i += 2
+		case "--tags":
+			if i+1 >= uint(len(args)) {
+				fmt.Println("--tags requires a value")
+				os.Exit(1)
+			}
+			for tag := range strings.SplitSeq(args[i+1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					serve_conf.tags = append(serve_conf.tags, tag)
+				}
+			}
+			i += 2
+		case "--openapi":
+			if i+1 >= uint(len(args)) {
+				fmt.Println("--openapi requires a value")
+				os.Exit(1)
+			}
+			serve_conf.openapi = args[i+1]
+			i += 2
 		case "-f", "--file":
 			fmt.Println("args", args, i)
 			if i+1 >= uint(len(args)) {
@@ -131,105 +191,489 @@ func (c *CLI) runServeCmd(args []string) {
 		}
 	}
 
-	if config_path == "" {
+	if config_path == "" && serve_conf.openapi == "" {
 		config_path = "config.yaml"
 	}
 	c.startServer(config_path, serve_conf)
 }
 
-func (c *CLI) startServer(config_path string, serve_config ServeConfig) {
-	log.Println("Starting Server...")
-	log.Printf("Config file %s", config_path)
-	log.Printf("Host: %s", serve_config.host)
-	log.Printf("Port: %d", serve_config.port)
-	if serve_config.rate_limiter {
-		log.Println("Limiter Enabled")
+func (c *CLI) runValidateCmd(args []string) error {
+	config_path := "config.yaml"
+	load_opts := config.LoadOptions{Strict: true, Profile: os.Getenv("APIHUB_PROFILE")}
+	check_schema := false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--profile":
+			if i+1 >= len(args) {
+				fmt.Println("--profile requires a value")
+				return errors.New("missing profile")
+			}
+			load_opts.Profile = args[i+1]
+			i++
+		case "--lenient":
+			load_opts.Lenient = true
+		case "--schema":
+			check_schema = true
+		case "-f", "--file":
+			if i+1 >= len(args) {
+				fmt.Println("filepath requires a value")
+				return errors.New("missing file path")
+			}
+			config_path = args[i+1]
+			i++
+		default:
+			config_path = args[i]
+		}
 	}
 
-	app_conf, err := config.LoadFromFile(config_path)
+	app_conf, err := config.Load(config_path, load_opts)
 	if err != nil {
 		fmt.Println(err.Error())
-		os.Exit(1)
+		return err
+	}
+
+	var problems []error
+	if check_schema {
+		for _, source := range app_conf.Sources {
+			errs, err := config.CheckSchema(source)
+			if err != nil {
+				fmt.Println(err.Error())
+				return err
+			}
+			problems = append(problems, errs...)
+		}
+	}
+	for _, p := range app_conf.Validate() {
+		problems = append(problems, p)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+
+	fmt.Printf("%s: %d rule(s) ok\n", config_path, len(app_conf.Rules))
+	return nil
+}
+
+func (c *CLI) runImportCmd(args []string) error {
+	if len(args) < 3 {
+		fmt.Println("usage: import openapi|har|postman|curl <source> [-o output]")
+		return errors.New("missing import source")
+	}
+
+	kind, source := args[1], args[2]
+	output := ""
+	har_opts := importer.HAROptions{}
+	for i := 3; i < len(args); i++ {
+		switch args[i] {
+		case "--group":
+			har_opts.Group = true
+		case "--strip-headers":
+			har_opts.StripHeaders = true
+		case "--generalize":
+			har_opts.Generalize = true
+		case "-o", "--output":
+			if i+1 >= len(args) {
+				fmt.Println("-o requires a value")
+				return errors.New("missing output path")
+			}
+			output = args[i+1]
+			i++
+		}
+	}
+
+	var rules []config.Rule
+	var err error
+	switch kind {
+	case "openapi":
+		rules, err = importer.OpenAPI(source)
+	case "har":
+		rules, err = importer.HAR(source, har_opts)
+	case "postman":
+		rules, err = importer.Postman(source)
+	case "curl":
+		rules, err = importer.Curl(source)
+	default:
+		fmt.Printf("unknown import source %q\n", kind)
+		return errors.New("unknown import source")
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
 	}
 
-	httpSrv := httpserver.CreateHttpServer()
+	return writeRules(rules, output)
+}
 
-	app_shop := app.Init(httpSrv, *app_conf)
+func (c *CLI) runExportCmd(args []string) error {
+	if len(args) < 2 || args[1] != "openapi" {
+		fmt.Println("usage: export openapi -f config.yaml [-o openapi.yaml] [--title name]")
+		return errors.New("unknown export target")
+	}
 
-	if serve_config.request_timeout == 0 {
-		serve_config.request_timeout = 30 * time.Second
+	config_path := "config.yaml"
+	output := ""
+	title := "apihub mocks"
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			fmt.Printf("%s requires a value\n", args[i])
+			return errors.New("missing flag value")
+		}
+		switch args[i] {
+		case "-f", "--file":
+			config_path = args[i+1]
+		case "-o", "--output":
+			output = args[i+1]
+		case "--title":
+			title = args[i+1]
+		default:
+			fmt.Printf("unknown flag %s\n", args[i])
+			return errors.New("unknown flag")
+		}
+		i++
 	}
 
-	rateLimit, err := strconv.Atoi(os.Getenv("APIHUB_RATELIMIT"))
+	app_conf, err := config.LoadFromFile(config_path)
 	if err != nil {
-		rateLimit = DEFAULT_RATELIMITER_LIMIT
+		fmt.Println(err.Error())
+		return err
 	}
 
-	rateLimitWindow, err := time.ParseDuration(os.Getenv("APIHUB_RATEWINDOW"))
+	data, err := config.Encode(exporter.OpenAPI(app_conf, title), filepath.Ext(output))
 	if err != nil {
-		rateLimitWindow = DEFAULT_RATELIMITER_WINDOW
+		fmt.Println(err.Error())
+		return err
+	}
+	if output == "" {
+		fmt.Print(string(data))
+		return nil
 	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	log.Printf("Wrote OpenAPI document to %s", output)
+	return nil
+}
 
-	server_config := interfaces.ServerConfig{
-		Host:                 serve_config.host,
-		Port:                 serve_config.port,
-		Max_request_size:     serve_config.max_request_size,
-		Request_timeout_ms:   uint64(serve_config.request_timeout.Milliseconds()),
-		Rate_limit:           serve_config.rate_limiter,
-		Rate_limit_requests:  uint32(rateLimit),
-		Rate_limit_window_ms: rateLimitWindow,
+func (c *CLI) runConvertCmd(args []string) error {
+	input := ""
+	output := ""
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-o", "--output":
+			if i+1 >= len(args) {
+				fmt.Printf("%s requires a value\n", args[i])
+				return errors.New("missing flag value")
+			}
+			output = args[i+1]
+			i++
+		default:
+			if input != "" || strings.HasPrefix(args[i], "-") {
+				fmt.Printf("unknown argument %s\n", args[i])
+				return errors.New("unknown argument")
+			}
+			input = args[i]
+		}
+	}
+	if input == "" {
+		fmt.Println("usage: convert config.yaml [-o config.toml]")
+		return errors.New("missing input file")
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	out, err := config.Convert(data, filepath.Ext(input), filepath.Ext(output))
+	if err != nil {
+		fmt.Printf("failed to convert %q: %s\n", input, err.Error())
+		return err
+	}
+	if output == "" {
+		fmt.Print(string(out))
+		return nil
+	}
+	if err := os.WriteFile(output, out, 0644); err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	log.Printf("Wrote %s", output)
+	return nil
+}
+
+func (c *CLI) runFmtCmd(args []string) error {
+	write := false
+	check := false
+	opts := config.FormatOptions{}
+	var paths []string
+	for _, arg := range args[1:] {
+		switch arg {
+		case "-w", "--write":
+			write = true
+		case "--check":
+			check = true
+		case "--sort":
+			opts.SortRules = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Printf("unknown flag %s\n", arg)
+				return errors.New("unknown flag")
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"config.yaml"}
+	}
+
+	// directories are formatted file by file, skipping response bodies and
+	// other files that aren't configs
+	var files []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == p {
+				if !entry.IsDir() {
+					files = append(files, path)
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				if entry.Name() == "bodies" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !slices.Contains([]string{".yaml", ".yml", ".json"}, filepath.Ext(path)) {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if config.IsConfig(data, filepath.Ext(path)) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+	}
+
+	unformatted := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+		out, err := config.Format(data, filepath.Ext(file), opts)
+		if err != nil {
+			fmt.Printf("%s: %s\n", file, err.Error())
+			return err
+		}
+		changed := !bytes.Equal(data, out)
+
+		switch {
+		case check:
+			if changed {
+				fmt.Println(file)
+				unformatted++
+			}
+		case write:
+			if !changed {
+				continue
+			}
+			if err := os.WriteFile(file, out, 0644); err != nil {
+				fmt.Println(err.Error())
+				return err
+			}
+			fmt.Println(file)
+		default:
+			fmt.Print(string(out))
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) not formatted", unformatted)
+	}
+	return nil
+}
+
+// writeRules prints rules to stdout, or writes them to output in the format
+// its extension names.
+func writeRules(rules []config.Rule, output string) error {
+	data, err := config.EncodeRules(rules, filepath.Ext(output))
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	if output == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Println(err.Error())
+		return err
 	}
+	log.Printf("Wrote %d rule(s) to %s", len(rules), output)
+	return nil
+}
 
-	startServer := func() {
-		if err := app_shop.Start(server_config); err != nil {
-			fmt.Printf("err: %v\n", err)
+func (c *CLI) startServer(config_path string, serve_config ServeConfig) {
+	log.Println("Starting Server...")
+	if config_path != "" {
+		log.Printf("Config file %s", config_path)
+	}
+	if serve_config.openapi != "" {
+		log.Printf("OpenAPI spec %s", serve_config.openapi)
+	}
+
+	load_opts := config.LoadOptions{
+		Strict:  serve_config.strict,
+		Lenient: serve_config.lenient,
+		Profile: serve_config.profile,
+	}
+	if load_opts.Profile == "" {
+		load_opts.Profile = os.Getenv("APIHUB_PROFILE")
+	}
+	if load_opts.Profile != "" {
+		log.Printf("Profile: %s", load_opts.Profile)
+	}
+	load := func() (*config.Config, error) {
+		conf := &config.Config{}
+		if config_path != "" {
+			loaded, err := config.Load(config_path, load_opts)
+			if err != nil {
+				return nil, err
+			}
+			conf = loaded
 		}
+		// rules from the config file take precedence over the spec
+		if serve_config.openapi != "" {
+			rules, err := importer.OpenAPI(serve_config.openapi)
+			if err != nil {
+				return nil, err
+			}
+			spec, err := config.FromRules(serve_config.openapi, rules)
+			if err != nil {
+				return nil, err
+			}
+			conf.Rules = append(conf.Rules, spec.Rules...)
+			conf.Sources = append(conf.Sources, spec.Sources...)
+		}
+		conf.FilterTags(serve_config.tags)
+		return conf, nil
+	}
+
+	app_conf, err := load()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	server_config := buildServerConfig(serve_config, app_conf.Server)
+	log.Printf("Host: %s", server_config.Host)
+	log.Printf("Port: %d", server_config.Port)
+	if server_config.Rate_limit {
+		log.Println("Limiter Enabled")
 	}
+
+	app_shop := app.Init(httpserver.CreateHttpServer(), *app_conf)
+
+	reload := make(chan *config.Config, 1)
 	// file watcher
 	if serve_config.watch {
-		log.Printf("Watching: %s", config_path)
 		watcher, err := fsnotify.NewWatcher()
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer watcher.Close()
 
-		if err := watcher.Add(config_path); err != nil {
-			log.Fatalf("Error watching file: %v", err)
+		// editors save by writing a temp file and renaming it over the
+		// original, which drops a watch on the file itself, so the parent
+		// directories are watched and events filtered by name
+		var files, dirs map[string]bool
+		watch := func(paths []string) {
+			newDirs := make(map[string]bool)
+			files = make(map[string]bool)
+			for _, p := range paths {
+				if abs, err := filepath.Abs(p); err == nil {
+					p = abs
+				}
+				files[p] = true
+				newDirs[filepath.Dir(p)] = true
+			}
+			for d := range dirs {
+				if !newDirs[d] {
+					watcher.Remove(d)
+				}
+			}
+			for d := range newDirs {
+				if dirs[d] {
+					continue
+				}
+				log.Printf("Watching: %s", d)
+				if err := watcher.Add(d); err != nil {
+					log.Printf("Error watching directory: %v", err)
+				}
+			}
+			dirs = newDirs
+		}
+		watch(app_conf.WatchPaths())
+
+		// relevant reports whether an event touches a loaded file, or a new
+		// config file in a watched directory
+		relevant := func(event fsnotify.Event) bool {
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				return false
+			}
+			name, err := filepath.Abs(event.Name)
+			if err != nil {
+				name = event.Name
+			}
+			return files[name] || slices.Contains(config.Extensions, filepath.Ext(name))
 		}
 
 		go func() {
-			debounce := time.Now()
+			// a save is often several events, reload once they settle
+			var settle <-chan time.Time
+			var changed string
 			for {
 				select {
 				case event, ok := <-watcher.Events:
 					if !ok {
 						return
 					}
-					if time.Since(debounce) < 500*time.Millisecond {
-						continue
+					if relevant(event) {
+						changed = event.Name
+						settle = time.After(300 * time.Millisecond)
 					}
-					debounce = time.Now()
-
-					if event.Op&(fsnotify.Write) != 0 {
-						// Clear terminal
-						fmt.Print("\033[H\033[2J")
-
-						log.Println("Config file modified — reloading server...")
-
-						// reload config and server
-						app_shop.Stop()
+				case <-settle:
+					settle = nil
+					// Clear terminal
+					fmt.Print("\033[H\033[2J")
 
-						newconf, err := config.LoadFromFile(config_path)
-						if err != nil {
-							log.Printf("Error reloading config: %v", err)
-							continue
-						}
+					log.Printf("%s modified — reloading server...", changed)
 
-						httpSrv = httpserver.CreateHttpServer()
-						app_shop = app.Init(httpSrv, *newconf)
-						startServer()
+					newconf, err := load()
+					if err != nil {
+						// the directories stay watched, the next save retries
+						log.Printf("Error reloading config: %v", err)
+						continue
 					}
+					// body files and includes may have been added or removed
+					watch(newconf.WatchPaths())
+					reload <- newconf
 				case err, ok := <-watcher.Errors:
 					if !ok {
 						return
@@ -240,23 +684,93 @@ func (c *CLI) startServer(config_path string, serve_config ServeConfig) {
 		}()
 	}
 
-	startServer()
+	for {
+		done := make(chan error, 1)
+		go func() {
+			done <- app_shop.Start(server_config)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				fmt.Printf("err: %v\n", err)
+			}
+			return
+		case newconf := <-reload:
+			app_shop.Stop()
+			<-done
+			app_shop = app.Init(httpserver.CreateHttpServer(), *newconf)
+		}
+	}
+}
+
+// buildServerConfig resolves server settings: CLI flags win over
+// APIHUB_* env vars, which win over the config file.
+func buildServerConfig(serve_config ServeConfig, file config.ServerSettings) interfaces.ServerConfig {
+	server_config := interfaces.ServerConfig{
+		Host:                 file.Host,
+		Port:                 file.Port,
+		Max_request_size:     file.MaxRequestSize,
+		Request_timeout_ms:   uint64(time.Duration(file.RequestTimeout).Milliseconds()),
+		Max_header_size:      file.MaxHeaderSize,
+		Rate_limit:           serve_config.rate_limiter,
+		Rate_limit_requests:  DEFAULT_RATELIMITER_LIMIT,
+		Rate_limit_window_ms: DEFAULT_RATELIMITER_WINDOW,
+	}
 
-	// done := make(chan os.Signal, 1)
-	// signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	if rl := file.RateLimit; rl != nil {
+		server_config.Rate_limit = server_config.Rate_limit || rl.IsEnabled()
+		if rl.Requests != 0 {
+			server_config.Rate_limit_requests = rl.Requests
+		}
+		if rl.Window != 0 {
+			server_config.Rate_limit_window_ms = time.Duration(rl.Window)
+		}
+	}
+
+	if rateLimit, err := strconv.Atoi(os.Getenv("APIHUB_RATELIMIT")); err == nil {
+		server_config.Rate_limit_requests = uint32(rateLimit)
+	}
+	if rateLimitWindow, err := time.ParseDuration(os.Getenv("APIHUB_RATEWINDOW")); err == nil {
+		server_config.Rate_limit_window_ms = rateLimitWindow
+	}
+
+	if serve_config.host != "" {
+		server_config.Host = serve_config.host
+	}
+	if serve_config.port != 0 {
+		server_config.Port = serve_config.port
+	}
+	if serve_config.max_request_size != 0 {
+		server_config.Max_request_size = serve_config.max_request_size
+	}
+	if serve_config.request_timeout != 0 {
+		server_config.Request_timeout_ms = uint64(serve_config.request_timeout.Milliseconds())
+	}
+	if server_config.Request_timeout_ms == 0 {
+		server_config.Request_timeout_ms = uint64((30 * time.Second).Milliseconds())
+	}
 
-	// <-done
-	// if err := app_shop.Stop(); err != nil {
-	// 	fmt.Printf("Error during shutdown: %v\n", err)
-	// 	os.Exit(1)
-	// }
+	return server_config
 }
 
 func (c CLI) printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("Commands")
 	fmt.Println(" serve [config.yaml] start the HTTP server")
-	fmt.Println("  -p port -w(watch config file) --max-request-size bytes")
+	fmt.Println("  -p port -w(watch config file) --max-request-size bytes --strict(fail on broken fragments)")
+	fmt.Println("  --lenient(ignore unknown config fields) --openapi spec.yaml(serve mocks for a spec)")
+	fmt.Println("  --tags a,b(only serve rules with one of the tags) --profile name(apply a config profile)")
+	fmt.Println(" validate -f [config file/folder] [--lenient] [--schema] [--profile name] check rules and exit non-zero on problems")
+	fmt.Println(" schema print the JSON Schema for config files")
+	fmt.Println(" import openapi spec.yaml [-o rules.yaml] convert a spec into mock rules")
+	fmt.Println(" import har session.har [-o rules.yaml] --group --strip-headers --generalize")
+	fmt.Println(" import postman collection.json [-o rules.yaml]")
+	fmt.Println(" import curl \"curl ...\" [-o rules.yaml]")
+	fmt.Println(" export openapi -f config.yaml [-o openapi.yaml] [--title name]")
+	fmt.Println(" init [-i] [--template mock-rest|proxy|mixed] [--resource users] [--base-url url] [-p port] [--layout] [-o path] [--force] write a starter config")
+	fmt.Println(" fmt [-w] [--check] [--sort] [files or folders] rewrite config files in canonical form")
+	fmt.Println(" convert config.yaml [-o config.toml] rewrite a config file as yaml, json, json5/jsonc or toml")
 	fmt.Println(" version")
 	fmt.Println(" -h or --help")
 }
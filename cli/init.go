@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var initTemplates = []string{"mock-rest", "proxy", "mixed"}
+
+type InitConfig struct {
+	Template string
+	Resource string
+	BaseURL  string
+	Port     uint16
+	// Layout writes a .apihub directory with rules/, bodies/ and a schema
+	// instead of a single config file.
+	Layout bool
+	Output string
+	Force  bool
+}
+
+// Mock and Proxy tell the templates which sections to write.
+func (i InitConfig) Mock() bool  { return i.Template != "proxy" }
+func (i InitConfig) Proxy() bool { return i.Template != "mock-rest" }
+
+func (c *CLI) runInitCmd(args []string) error {
+	init_conf := InitConfig{
+		Template: "mock-rest",
+		Resource: "users",
+		BaseURL:  "http://localhost:9000",
+		Port:     8080,
+	}
+	interactive := len(args) == 1 && isTerminal(os.Stdin)
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-i", "--interactive":
+			interactive = true
+			continue
+		case "--layout":
+			init_conf.Layout = true
+			continue
+		case "--force":
+			init_conf.Force = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			fmt.Printf("unknown flag %s\n", arg)
+			return errors.New("unknown flag")
+		}
+		value := args[i+1]
+		i++
+		switch arg {
+		case "-t", "--template":
+			init_conf.Template = value
+		case "--resource":
+			init_conf.Resource = value
+		case "--base-url":
+			init_conf.BaseURL = value
+		case "-p", "--port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				fmt.Println("port should be an int")
+				return err
+			}
+			init_conf.Port = uint16(port)
+		case "-o", "--output":
+			init_conf.Output = value
+		default:
+			fmt.Printf("unknown flag %s\n", arg)
+			return errors.New("unknown flag")
+		}
+	}
+
+	if interactive {
+		if err := promptInit(os.Stdin, os.Stdout, &init_conf); err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+	}
+	if !slices.Contains(initTemplates, init_conf.Template) {
+		fmt.Printf("unknown template %q, use one of %s\n", init_conf.Template, strings.Join(initTemplates, ", "))
+		return errors.New("unknown template")
+	}
+	init_conf.Resource = strings.Trim(init_conf.Resource, "/")
+
+	written, err := writeScaffold(init_conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	for _, f := range written {
+		fmt.Printf("created %s\n", f)
+	}
+
+	// the templates should always produce a valid config
+	conf, err := config.Load(written[0], config.LoadOptions{Strict: true, Validate: true})
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	fmt.Printf("%d rule(s), start with: apihub serve -f %s\n", len(conf.Rules), written[0])
+	return nil
+}
+
+// isTerminal reports whether f is a character device other than the null
+// device, which is close enough to a terminal without extra dependencies.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// promptInit asks for every InitConfig setting, keeping the current value
+// on an empty answer.
+func promptInit(in io.Reader, out io.Writer, init_conf *InitConfig) error {
+	scanner := bufio.NewScanner(in)
+	ask := func(question, current string) string {
+		fmt.Fprintf(out, "%s [%s]: ", question, current)
+		if !scanner.Scan() {
+			return current
+		}
+		if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+			return answer
+		}
+		return current
+	}
+
+	init_conf.Template = ask("Template ("+strings.Join(initTemplates, ", ")+")", init_conf.Template)
+	if init_conf.Template != "proxy" {
+		init_conf.Resource = ask("Resource name", init_conf.Resource)
+	}
+	if init_conf.Template != "mock-rest" {
+		init_conf.BaseURL = ask("Upstream base URL", init_conf.BaseURL)
+	}
+	port, err := strconv.Atoi(ask("Port", strconv.Itoa(int(init_conf.Port))))
+	if err != nil {
+		return errors.New("port should be an int")
+	}
+	init_conf.Port = uint16(port)
+
+	layout := "n"
+	if init_conf.Layout {
+		layout = "y"
+	}
+	init_conf.Layout = strings.HasPrefix(strings.ToLower(ask("Create a .apihub directory with rules/ and bodies/ (y/n)", layout)), "y")
+	return scanner.Err()
+}
+
+// writeScaffold renders the templates and returns the written files, the
+// main config file first.
+func writeScaffold(init_conf InitConfig) ([]string, error) {
+	tmpl, err := template.ParseFS(templateFS, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	render := func(name string) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, init_conf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	type file struct {
+		path     string
+		template string
+	}
+	var files []file
+	if init_conf.Layout {
+		dir := init_conf.Output
+		if dir == "" {
+			dir = ".apihub"
+		}
+		files = append(files,
+			file{filepath.Join(dir, "config.yaml"), "config.yaml.tmpl"},
+			file{filepath.Join(dir, "rules", init_conf.Template+".yaml"), "rules-file.yaml.tmpl"},
+		)
+		if init_conf.Mock() {
+			files = append(files, file{filepath.Join(dir, "bodies", init_conf.Resource+".json"), "body.json.tmpl"})
+		}
+		files = append(files, file{filepath.Join(dir, "apihub.schema.json"), ""})
+	} else {
+		output := init_conf.Output
+		if output == "" {
+			output = "config.yaml"
+		}
+		files = append(files, file{output, "config.yaml.tmpl"})
+	}
+
+	if !init_conf.Force {
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				return nil, fmt.Errorf("%s already exists, use --force to overwrite it", f.path)
+			}
+		}
+	}
+
+	var written []string
+	for _, f := range files {
+		var data []byte
+		if f.template == "" {
+			data, err = config.SchemaJSON()
+		} else {
+			data, err = render(f.template)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// configs are written the way apihub fmt would, so fmt --check
+		// passes right away
+		if filepath.Ext(f.path) == ".yaml" {
+			if data, err = config.Format(data, ".yaml", config.FormatOptions{}); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f.path, data, 0644); err != nil {
+			return nil, err
+		}
+		written = append(written, f.path)
+	}
+	return written, nil
+}
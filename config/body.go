@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Body is a mock response body written either as a plain string or as a
+// structured YAML/JSON value. Structured values are serialized into Text
+// when the config is loaded.
+type Body struct {
+	Text string
+	Data any
+}
+
+func (b Body) IsStructured() bool {
+	return b.Data != nil
+}
+
+func (b *Body) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		b.Text = node.Value
+		return nil
+	}
+	return node.Decode(&b.Data)
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '"' {
+		return json.Unmarshal(data, &b.Text)
+	}
+	return json.Unmarshal(data, &b.Data)
+}
+
+func (b Body) MarshalYAML() (any, error) {
+	if b.Data != nil {
+		return b.Data, nil
+	}
+	return b.Text, nil
+}
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if b.Data != nil {
+		return json.Marshal(b.Data)
+	}
+	return json.Marshal(b.Text)
+}
+
+var bodyContentTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml",
+	"yaml": "application/yaml",
+	"form": "application/x-www-form-urlencoded",
+}
+
+// renderBody serializes a structured body according to body_format and sets
+// a matching content-type header unless one is configured.
+func renderBody(res *MockResponse) error {
+	if !res.Body.IsStructured() {
+		return nil
+	}
+
+	format := res.BodyFormat
+	if format == "" {
+		format = "json"
+	}
+
+	var out []byte
+	var err error
+	switch format {
+	case "json":
+		out, err = json.Marshal(res.Body.Data)
+	case "yaml":
+		out, err = yaml.Marshal(res.Body.Data)
+	case "xml":
+		out, err = marshalXML(res.Body.Data)
+	case "form":
+		out, err = marshalForm(res.Body.Data)
+	default:
+		return fmt.Errorf("unknown body_format %q (use json, xml, yaml or form)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("serializing body as %s: %v", format, err)
+	}
+	res.Body.Text = string(out)
+
+	for key := range res.Headers {
+		if strings.EqualFold(key, "content-type") {
+			return nil
+		}
+	}
+	if res.Headers == nil {
+		res.Headers = make(map[string]any)
+	}
+	res.Headers["content-type"] = bodyContentTypes[format]
+	return nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// marshalXML writes maps as elements and lists as repeated <item> elements.
+// A map with a single key becomes the document root, anything else is
+// wrapped in <root>.
+func marshalXML(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+
+	var write func(name string, v any) error
+	write = func(name string, v any) error {
+		start := xml.StartElement{Name: xml.Name{Local: name}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			for _, k := range sortedKeys(val) {
+				if err := write(k, val[k]); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, item := range val {
+				if err := write("item", item); err != nil {
+					return err
+				}
+			}
+		case nil:
+		default:
+			if err := enc.EncodeToken(xml.CharData(fmt.Sprint(val))); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+
+	var err error
+	if m, ok := data.(map[string]any); ok && len(m) == 1 {
+		for k, v := range m {
+			err = write(k, v)
+		}
+	} else {
+		err = write("root", data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalForm flattens nested maps with bracket keys (a[b]=c) and repeats
+// keys for lists.
+func marshalForm(data any) ([]byte, error) {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("form bodies must be a mapping")
+	}
+
+	values := url.Values{}
+	var add func(key string, v any)
+	add = func(key string, v any) {
+		switch val := v.(type) {
+		case map[string]any:
+			for _, k := range sortedKeys(val) {
+				add(key+"["+k+"]", val[k])
+			}
+		case []any:
+			for _, item := range val {
+				add(key, item)
+			}
+		case nil:
+			values.Add(key, "")
+		default:
+			values.Add(key, fmt.Sprint(val))
+		}
+	}
+	for _, k := range sortedKeys(m) {
+		add(k, m[k])
+	}
+	return []byte(values.Encode()), nil
+}
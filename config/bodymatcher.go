@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BodyMatcher checks the request body. In config files a scalar is an exact
+// match and a mapping sets the fields below. All fields that are set must
+// match.
+type BodyMatcher struct {
+	// Equals matches when the body is exactly this.
+	Equals *string `yaml:"equals,omitempty" json:"equals,omitempty"`
+	// Regex matches when the body matches this regular expression.
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	// JSON matches a JSON body that contains this value: objects may have
+	// more keys and arrays more items. A string holding a JSON object or
+	// array is parsed first.
+	JSON any `yaml:"json,omitempty" json:"json,omitempty"`
+	// JSONPath maps expressions like $.user.id or $.items[*].sku to the
+	// value one of the selected nodes must contain.
+	JSONPath map[string]any `yaml:"jsonpath,omitempty" json:"jsonpath,omitempty"`
+	// Form matches fields of urlencoded and multipart bodies. File parts
+	// match by file name.
+	Form map[string]Matcher `yaml:"form,omitempty" json:"form,omitempty"`
+}
+
+// bodyMatcherFields is BodyMatcher without its decoding methods.
+type bodyMatcherFields BodyMatcher
+
+var bodyMatcherType = reflect.TypeFor[BodyMatcher]()
+var bodyMatcherFieldsType = reflect.TypeFor[bodyMatcherFields]()
+
+// compile checks the regexes and JSONPath expressions.
+func (b *BodyMatcher) compile() error {
+	if b.Regex != "" {
+		if _, err := compileRegex(b.Regex); err != nil {
+			return err
+		}
+	}
+	for expr := range b.JSONPath {
+		if _, err := parseJSONPath(expr); err != nil {
+			return err
+		}
+	}
+	for name, m := range b.Form {
+		if err := m.check(); err != nil {
+			return fmt.Errorf("form %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (b *BodyMatcher) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value := node.Value
+		*b = BodyMatcher{Equals: &value}
+		return nil
+	case yaml.MappingNode:
+		var fields bodyMatcherFields
+		if err := node.Decode(&fields); err != nil {
+			return err
+		}
+		*b = BodyMatcher(fields)
+		if err := b.compile(); err != nil {
+			return fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: body matcher must be a string or a mapping", node.Line)
+}
+
+func (b *BodyMatcher) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var fields bodyMatcherFields
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return err
+		}
+		*b = BodyMatcher(fields)
+		return b.compile()
+	}
+	var s string
+	if err := json.Unmarshal(trimmed, &s); err != nil {
+		return fmt.Errorf("body matcher must be a string or an object")
+	}
+	*b = BodyMatcher{Equals: &s}
+	return nil
+}
+
+// simple reports whether b is only an exact value, the form it is written
+// back in.
+func (b BodyMatcher) simple() bool {
+	return b.Equals != nil && b.Regex == "" && b.JSON == nil && b.JSONPath == nil && b.Form == nil
+}
+
+func (b BodyMatcher) MarshalYAML() (any, error) {
+	if b.simple() {
+		return *b.Equals, nil
+	}
+	return bodyMatcherFields(b), nil
+}
+
+func (b BodyMatcher) MarshalJSON() ([]byte, error) {
+	if b.simple() {
+		return json.Marshal(*b.Equals)
+	}
+	return json.Marshal(bodyMatcherFields(b))
+}
+
+// Match reports whether body, sent with the given Content-Type, satisfies b.
+func (b *BodyMatcher) Match(body []byte, contentType string) bool {
+	if b.Equals != nil && string(body) != *b.Equals {
+		return false
+	}
+	if b.Regex != "" {
+		re, err := compileRegex(b.Regex)
+		if err != nil || !re.Match(body) {
+			return false
+		}
+	}
+
+	if b.JSON != nil || len(b.JSONPath) > 0 {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return false
+		}
+		if b.JSON != nil && !jsonContains(doc, jsonValue(b.JSON)) {
+			return false
+		}
+		for expr, want := range b.JSONPath {
+			steps, err := parseJSONPath(expr)
+			if err != nil {
+				return false
+			}
+			want = jsonValue(want)
+			if !slices.ContainsFunc(evalJSONPath(steps, doc), func(got any) bool {
+				return jsonContains(got, want)
+			}) {
+				return false
+			}
+		}
+	}
+
+	if len(b.Form) > 0 {
+		form := formValues(body, contentType)
+		for name, m := range b.Form {
+			values, present := form[name]
+			if !m.Match(values, present) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// jsonValue converts a value decoded from a config file to what
+// encoding/json decodes the same value to, so numbers compare as float64.
+func jsonValue(v any) any {
+	if s, ok := v.(string); ok {
+		trimmed := strings.TrimSpace(s)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			return v
+		}
+		var parsed any
+		if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+			return parsed
+		}
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// jsonContains reports whether got contains want: every key of an object
+// and every item of an array in want must be matched in got.
+func jsonContains(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok || !jsonContains(gv, wv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return false
+		}
+		for _, wv := range w {
+			if !slices.ContainsFunc(g, func(gv any) bool { return jsonContains(gv, wv) }) {
+				return false
+			}
+		}
+		return true
+	}
+	return got == want
+}
+
+// formValues parses an urlencoded or multipart body. Other bodies have no
+// form fields.
+func formValues(body []byte, contentType string) url.Values {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, _ := url.ParseQuery(string(body))
+		return values
+	case "multipart/form-data":
+		values := make(url.Values)
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return values
+			}
+			name := part.FormName()
+			if name == "" {
+				continue
+			}
+			if file := part.FileName(); file != "" {
+				values.Add(name, file)
+				continue
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return values
+			}
+			values.Add(name, string(data))
+		}
+	}
+	return nil
+}
@@ -1,39 +1,58 @@
 package config
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 type RequestRule struct {
-	Path    string         `yaml:"path" json:"path"`
-	Method  string         `yaml:"method" json:"method"`
-	Headers map[string]any `yaml:"headers" json:"headers"`
-	Body    string         `yaml:"body" json:"body"`
-	Params  map[string]string
+	Path   string `yaml:"path" json:"path"`
+	Method string `yaml:"method" json:"method"`
+	// Host matches the request Host, *.example.com matches any subdomain.
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// Headers match request headers by name.
+	Headers map[string]Matcher `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// Query matches query parameters by name.
+	Query map[string]Matcher `yaml:"query,omitempty" json:"query,omitempty"`
+	// Cookies match request cookies by name.
+	Cookies map[string]Matcher `yaml:"cookies,omitempty" json:"cookies,omitempty"`
+	// Body matches the request body.
+	Body *BodyMatcher `yaml:"body,omitempty" json:"body,omitempty"`
 }
 
 type MockResponse struct {
-	Status  uint16         `yaml:"status" json:"status"`
-	Headers map[string]any `yaml:"headers" json:"headers"`
-	Body    string         `yaml:"body" json:"body"`
+	Status     uint16         `yaml:"status,omitempty" json:"status,omitempty"`
+	Headers    map[string]any `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body       Body           `yaml:"body,omitempty" json:"body,omitzero"`
+	BodyFormat string         `yaml:"body_format,omitempty" json:"body_format,omitempty"`
+	BodyFile   string         `yaml:"body_file,omitempty" json:"body_file,omitempty"`
 }
 
 type ProxyConfig struct {
-	Url       string            `yaml:"url" json:"url"`
-	Headers   map[string]string `yaml:"headers" json:"headers"`
-	TimeoutMs uint64            `yaml:"timeout" json:"timeout"`
+	Url       string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	TimeoutMs uint64            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
 }
 
 type Rule struct {
-	Request  *RequestRule  `yaml:"request" json:"request"`
-	Response *MockResponse `yaml:"response" json:"response"`
-	Proxy    *ProxyConfig  `yaml:"proxy" json:"proxy"`
+	Name     string        `yaml:"name,omitempty" json:"name,omitempty"`
+	Tags     []string      `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Priority int           `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Request  *RequestRule  `yaml:"request,omitempty" json:"request,omitempty"`
+	Response *MockResponse `yaml:"response,omitempty" json:"response,omitempty"`
+	Proxy    *ProxyConfig  `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+
+	// File and Index record where the rule was loaded from. Index counts
+	// within Group for grouped rules.
+	File  string `yaml:"-" json:"-"`
+	Index int    `yaml:"-" json:"-"`
+	Group *Group `yaml:"-" json:"-"`
 }
 
 func (r Rule) IsProxyStatic() bool {
@@ -65,91 +84,393 @@ func (r *Rule) IsProxy() bool {
 }
 
 type Config struct {
-	Rules []Rule
+	Server ServerSettings
+	Rules  []Rule
+	// Sources lists every config file that was loaded.
+	Sources []string
+	// FS is the file system body files are read from when the config was
+	// loaded with LoadFS. It is nil for configs read from disk.
+	FS fs.FS
 }
 
-func loadFromDirectory(dirPath string) (*Config, error) {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return nil, err
+// Open opens a body file, from FS when the config was loaded from one.
+func (c *Config) Open(name string) (fs.File, error) {
+	if c.FS != nil {
+		return c.FS.Open(name)
 	}
+	return os.Open(name)
+}
 
-	config := &Config{}
+// WatchPaths returns the config files and body files the rules depend on.
+func (c *Config) WatchPaths() []string {
+	paths := slices.Clone(c.Sources)
+	for _, r := range c.Rules {
+		if r.Response != nil && r.Response.BodyFile != "" && !slices.Contains(paths, r.Response.BodyFile) {
+			paths = append(paths, r.Response.BodyFile)
+		}
+	}
+	return paths
+}
+
+type LoadOptions struct {
+	// Strict turns parse failures in directory files and includes into errors
+	// instead of warnings.
+	Strict bool
+	// Lenient ignores unknown fields instead of rejecting them.
+	Lenient bool
+	// Profile selects the profiles: blocks and overlay file to apply.
+	Profile string
+	// Validate runs Validate after loading and returns the problems as
+	// ValidationErrors.
+	Validate bool
+}
+
+// loader keeps track of files across includes and directory walks. Paths
+// inside the loader are slash-separated paths in fsys, name turns them back
+// into the paths users see.
+type loader struct {
+	opts     LoadOptions
+	fsys     fs.FS
+	root     string
+	loaded   map[string]bool
+	files    []string
+	stack    []string
+	profiles []*Profile
+	// vars holds the vars: of the file being loaded and the files that
+	// included it.
+	vars map[string]string
+	// top is the file or directory being loaded. When it is a file, its
+	// vars and defaults also apply to the rules of a profile overlay.
+	top         string
+	topVars     map[string]string
+	topDefaults *Defaults
+}
 
-	for _, entry := range entries {
-		stat, err := entry.Info()
+func newLoader(fsys fs.FS, root string, opts LoadOptions) *loader {
+	return &loader{
+		opts:   opts,
+		fsys:   fsys,
+		root:   root,
+		loaded: make(map[string]bool),
+	}
+}
+
+// name returns the path a file in fsys is reported as, an OS path when
+// loading from disk.
+func (l *loader) name(p string) string {
+	if l.root == "" {
+		return p
+	}
+	return filepath.Join(l.root, filepath.FromSlash(p))
+}
+
+// resolve turns a path written in the file at from into a path in fsys.
+func (l *loader) resolve(from, p string) (string, error) {
+	if filepath.IsAbs(p) {
+		if l.root == "" {
+			return "", fmt.Errorf("absolute path %q is not allowed", p)
+		}
+		rel, err := filepath.Rel(l.root, p)
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	return path.Join(path.Dir(from), filepath.ToSlash(p)), nil
+}
+
+func (l *loader) readFile(p string) ([]byte, error) {
+	data, err := fs.ReadFile(l.fsys, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &NotFoundError{Path: l.name(p), Err: err}
+	}
+	return data, err
+}
+
+// prepareRules records where rules came from and resolves everything that
+// depends on the file they were declared in.
+func (l *loader) prepareRules(p string, rules []Rule, defaults *Defaults) error {
+	file := l.name(p)
+	for i := range rules {
+		rules[i].File = file
+		rules[i].Index = i
+		defaults.apply(&rules[i])
+		if err := expandRule(&rules[i], l.vars); err != nil {
+			return err
 		}
-		if stat.IsDir() {
-			continue
+		if res := rules[i].Response; res != nil {
+			if res.BodyFile != "" && !filepath.IsAbs(res.BodyFile) {
+				res.BodyFile = l.name(path.Join(path.Dir(p), filepath.ToSlash(res.BodyFile)))
+			}
+			if err := renderBody(res); err != nil {
+				return ruleError(&rules[i], err)
+			}
 		}
-		ext := filepath.Ext(filepath.Join(dirPath, entry.Name()))
-		if ext != ".yml" && ext != ".yaml" && ext != ".json" {
-			continue
+	}
+	return nil
+}
+
+// ruleError prefixes err with the file, group and index of r.
+func ruleError(r *Rule, err error) error {
+	if r.Group != nil {
+		return fmt.Errorf("%s: group %s rule %d: %v", r.File, r.Group.Label(), r.Index, err)
+	}
+	return fmt.Errorf("%s: rule %d: %v", r.File, r.Index, err)
+}
+
+func isConfigFile(path string) bool {
+	return slices.Contains(Extensions, filepath.Ext(path))
+}
+
+// fragment loads a file pulled in by a directory walk or an include. In
+// non-strict mode files that fail to parse are reported and skipped, any
+// other error still fails the load.
+func (l *loader) fragment(p string, into *Config) error {
+	conf, err := l.loadFile(p)
+	if err != nil {
+		var parseErr *ParseError
+		if l.opts.Strict || !errors.As(err, &parseErr) {
+			return err
 		}
+		fmt.Fprintf(os.Stderr, "skipping %s: %v\n", parseErr.File, parseErr.Err)
+		return nil
+	}
+	into.Server.merge(&conf.Server)
+	into.Rules = append(into.Rules, conf.Rules...)
+	return nil
+}
 
-		conf, err := loadSingleFile(filepath.Join(dirPath, entry.Name()))
+// loadDirectory walks dir recursively in lexical order.
+func (l *loader) loadDirectory(dir string) (*Config, error) {
+	config := &Config{}
+
+	err := fs.WalkDir(l.fsys, dir, func(p string, entry fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to parse %s/%s: %v", dirPath, entry.Name(), err)
-			continue
+			return err
 		}
-		for _, c := range conf.Rules {
-			config.Rules = append(config.Rules, c)
+		if entry.IsDir() || !isConfigFile(p) {
+			return nil
 		}
+		return l.fragment(p, config)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
-func loadSingleFile(path string) (*Config, error) {
-	file, err := os.Open(path)
+type IncludeCycleError struct {
+	Chain []string
+}
+
+func (e IncludeCycleError) Error() string {
+	return "include cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+// loadFile loads a single file and everything it includes. A file that has
+// already been loaded contributes nothing the second time.
+func (l *loader) loadFile(p string) (*Config, error) {
+	if slices.Contains(l.stack, p) {
+		chain := make([]string, 0, len(l.stack)+1)
+		for _, f := range append(slices.Clone(l.stack), p) {
+			chain = append(chain, l.name(f))
+		}
+		return nil, IncludeCycleError{Chain: chain}
+	}
+	if l.loaded[p] {
+		return &Config{}, nil
+	}
+	l.loaded[p] = true
+	l.files = append(l.files, l.name(p))
+
+	l.stack = append(l.stack, p)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	data, err := l.readFile(p)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	ext := filepath.Ext(path)
-	var rules []Rule
+	doc, err := decodeDocument(data, path.Ext(p), !l.opts.Lenient)
+	if err != nil {
+		var ref *refError
+		if errors.As(err, &ref) {
+			return nil, fmt.Errorf("%s: %v", l.name(p), err)
+		}
+		return nil, &ParseError{File: l.name(p), Err: err}
+	}
 
-	var decodeErr error
+	inherited := l.vars
+	defer func() { l.vars = inherited }()
+	if l.vars, err = expandVars(doc.Vars, inherited); err != nil {
+		return nil, fmt.Errorf("%s: %v", l.name(p), err)
+	}
+	if p == l.top {
+		l.topVars, l.topDefaults = l.vars, doc.Defaults
+	}
 
-	switch ext {
-	case ".yaml", ".yml":
-		decodeErr = yaml.NewDecoder(file).Decode(&rules)
-	case ".json":
-		decodeErr = json.NewDecoder(file).Decode(&rules)
-	default:
-		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	rules := doc.Rules
+	if err := l.prepareRules(p, rules, doc.Defaults); err != nil {
+		return nil, err
+	}
+	grouped, err := l.loadGroups(p, doc.Groups, doc.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, grouped...)
+	if profile, ok := doc.Profiles[l.opts.Profile]; ok && l.opts.Profile != "" {
+		if err := l.prepareRules(p, profile.Rules, doc.Defaults); err != nil {
+			return nil, err
+		}
+		l.profiles = append(l.profiles, profile)
 	}
 
-	if decodeErr != nil {
-		return nil, fmt.Errorf("failed to decode %q: %s", path, decodeErr.Error())
+	// the including file's rules come first so they win over fragments,
+	// while its server settings are merged last so they override them
+	included := &Config{}
+	for _, include := range doc.Include {
+		pattern, err := l.resolve(p, include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %q: %v", l.name(p), include, err)
+		}
+		matches, err := fs.Glob(l.fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %q: %v", l.name(p), include, err)
+		}
+		if len(matches) == 0 {
+			if l.opts.Strict {
+				return nil, fmt.Errorf("%s: include %q matched no files", l.name(p), include)
+			}
+			fmt.Fprintf(os.Stderr, "%s: include %q matched no files\n", l.name(p), include)
+		}
+		for _, m := range matches {
+			info, err := fs.Stat(l.fsys, m)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				conf, err := l.loadDirectory(m)
+				if err != nil {
+					return nil, err
+				}
+				included.Server.merge(&conf.Server)
+				included.Rules = append(included.Rules, conf.Rules...)
+				continue
+			}
+			if !isConfigFile(m) {
+				continue
+			}
+			if err := l.fragment(m, included); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	return &Config{Rules: rules}, nil
+	config := &Config{Rules: rules}
+	config.Rules = append(config.Rules, included.Rules...)
+	config.Server.merge(&included.Server)
+	config.Server.merge(doc.Server)
+	return config, nil
 }
 
-func LoadFromFile(path string) (*Config, error) {
-	cwd, err := os.Getwd()
+// load reads name, a file or a directory in l.fsys, and applies the selected
+// profile.
+func (l *loader) load(name string) (*Config, error) {
+	info, err := fs.Stat(l.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &NotFoundError{Path: l.name(name), Err: err}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("%v", err.Error())
+		return nil, err
 	}
 
-	fullPath := filepath.Join(cwd, path)
+	l.top = name
+	var config *Config
+	if info.IsDir() {
+		config, err = l.loadDirectory(name)
+	} else {
+		config, err = l.loadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	file, err := os.OpenFile(fullPath, os.O_RDONLY, 0644)
+	if l.opts.Profile != "" {
+		profiles := l.profiles
+		if overlay := l.overlayPath(name, info.IsDir(), l.opts.Profile); overlay != "" {
+			profile, err := l.loadOverlay(overlay)
+			if err != nil {
+				return nil, err
+			}
+			profiles = append(profiles, profile)
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("profile %q not found", l.opts.Profile)
+		}
+		for _, p := range profiles {
+			if err := config.applyProfile(l.opts.Profile, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	config.Sources = l.files
+	if l.root == "" {
+		config.FS = l.fsys
+	}
+	if l.opts.Validate {
+		if errs := config.Validate(); len(errs) > 0 {
+			return nil, ValidationErrors(errs)
+		}
+	}
+	return config, nil
+}
+
+// FromRules builds a Config from rules that weren't read from a config
+// file, such as rules imported from an API spec.
+func FromRules(source string, rules []Rule) (*Config, error) {
+	for i := range rules {
+		rules[i].File = source
+		rules[i].Index = i
+		if res := rules[i].Response; res != nil {
+			if err := renderBody(res); err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %v", source, i, err)
+			}
+		}
+	}
+	return &Config{Rules: rules, Sources: []string{source}}, nil
+}
+
+func LoadFromFile(path string) (*Config, error) {
+	return Load(path, LoadOptions{})
+}
+
+// Load reads a config file or directory from disk. Relative paths are
+// relative to the working directory, and the returned Sources and body
+// files are absolute.
+func Load(name string, opts LoadOptions) (*Config, error) {
+	abs, err := filepath.Abs(name)
 	if err != nil {
-		fmt.Println("error opening file:", err)
-		os.Exit(1)
+		return nil, err
 	}
-	stat, err := file.Stat()
+	// load from the file system root so includes can leave the config
+	// directory
+	root := filepath.VolumeName(abs) + string(filepath.Separator)
+	rel, err := filepath.Rel(root, abs)
 	if err != nil {
-		return nil, fmt.Errorf("error getting file info: %v", err)
+		return nil, err
 	}
-	if stat.IsDir() {
-		return loadFromDirectory(fullPath)
-	} else {
-		return loadSingleFile(fullPath)
+
+	return newLoader(os.DirFS(root), root, opts).load(filepath.ToSlash(rel))
+}
+
+// LoadFS reads a config file or directory from fsys. name, includes and
+// body files are paths in fsys, and the returned Config reads body files
+// from it.
+func LoadFS(fsys fs.FS, name string, opts LoadOptions) (*Config, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
 	}
+	return newLoader(fsys, "", opts).load(name)
 }
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFragmentErrors(t *testing.T) {
+	const good = "- request: { path: /good, method: GET }\n  response: { status: 200 }\n"
+	tests := []struct {
+		name     string
+		fragment string
+		// the errors in strict and lenient mode, "" when loading works
+		strictErr, lenientErr string
+		lenientRules          int
+	}{
+		{
+			name:         "parse error",
+			fragment:     "- request: [",
+			strictErr:    `failed to decode "rules/bad.yaml"`,
+			lenientRules: 1,
+		},
+		{
+			name:         "unknown field",
+			fragment:     "- request: { path: /b, method: GET }\n  nope: 1\n",
+			strictErr:    `failed to decode "rules/bad.yaml"`,
+			lenientRules: 1,
+		},
+		{
+			name:       "unset variable",
+			fragment:   "- request: { path: \"/${APIHUB_TEST_UNSET}\", method: GET }\n  response: { status: 200 }\n",
+			strictErr:  `environment variable "APIHUB_TEST_UNSET" is not set`,
+			lenientErr: `environment variable "APIHUB_TEST_UNSET" is not set`,
+		},
+		{
+			name:       "missing secret",
+			fragment:   "- request: { path: /b, method: GET }\n  response: { status: 200, body: \"${file:/nonexistent/apihub-secret}\" }\n",
+			strictErr:  "reading secret",
+			lenientErr: "reading secret",
+		},
+		{
+			name:       "bad ref",
+			fragment:   "- $ref: \"#/fragments/missing\"\n",
+			strictErr:  "missing",
+			lenientErr: "missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"rules/a.yaml":   {Data: []byte(good)},
+				"rules/bad.yaml": {Data: []byte(tt.fragment)},
+			}
+			for _, strict := range []bool{true, false} {
+				want := tt.lenientErr
+				if strict {
+					want = tt.strictErr
+				}
+				conf, err := LoadFS(fsys, "rules", LoadOptions{Strict: strict})
+				switch {
+				case want == "" && err != nil:
+					t.Errorf("strict=%v: LoadFS: %v", strict, err)
+				case want == "" && len(conf.Rules) != tt.lenientRules:
+					t.Errorf("strict=%v: got %d rules, want %d", strict, len(conf.Rules), tt.lenientRules)
+				case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+					t.Errorf("strict=%v: LoadFS error = %v, want one containing %q", strict, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadStrictParseError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("include: [bad.yaml]\n")},
+		"bad.yaml":    {Data: []byte("- request: [")},
+	}
+	_, err := LoadFS(fsys, "config.yaml", LoadOptions{Strict: true})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "bad.yaml" {
+		t.Fatalf("LoadFS error = %v, want a ParseError for bad.yaml", err)
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	rule := func(path string) string {
+		return "- request: { path: " + path + ", method: GET }\n  response: { status: 200 }\n"
+	}
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("include: [a.yaml, shared.yaml]\nrules:\n" + indent(rule("/root")))},
+		"a.yaml":      {Data: []byte("include: [sub/*.yaml]\nrules:\n" + indent(rule("/a")))},
+		"sub/b.yaml":  {Data: []byte(rule("/b"))},
+		"sub/c.yaml":  {Data: []byte("include: [../shared.yaml]\nrules:\n" + indent(rule("/c")))},
+		"shared.yaml": {Data: []byte(rule("/shared"))},
+	}
+	conf, err := LoadFS(fsys, "config.yaml", LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range conf.Rules {
+		paths = append(paths, r.Request.Path)
+	}
+	// shared.yaml is included twice but loaded once, where it is first met
+	want := []string{"/root", "/a", "/b", "/c", "/shared"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("rules = %v, want %v", paths, want)
+	}
+	if len(conf.Sources) != 5 {
+		t.Errorf("sources = %v, want 5 files", conf.Sources)
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("include: [a.yaml]\n")},
+		"a.yaml":      {Data: []byte("include: [b.yaml]\n")},
+		"b.yaml":      {Data: []byte("include: [a.yaml]\n")},
+	}
+	for _, strict := range []bool{true, false} {
+		_, err := LoadFS(fsys, "config.yaml", LoadOptions{Strict: strict})
+		var cycle IncludeCycleError
+		if !errors.As(err, &cycle) {
+			t.Fatalf("strict=%v: LoadFS error = %v, want an IncludeCycleError", strict, err)
+		}
+		want := []string{"config.yaml", "a.yaml", "b.yaml", "a.yaml"}
+		if strings.Join(cycle.Chain, " ") != strings.Join(want, " ") {
+			t.Errorf("strict=%v: chain = %v, want %v", strict, cycle.Chain, want)
+		}
+	}
+}
+
+func TestLoadIncludeParseError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("include: [good.yaml, bad.yaml]\n")},
+		"good.yaml":   {Data: []byte("- request: { path: /good, method: GET }\n  response: { status: 200 }\n")},
+		"bad.yaml":    {Data: []byte("- request: [")},
+	}
+	if _, err := LoadFS(fsys, "config.yaml", LoadOptions{Strict: true}); err == nil {
+		t.Error("strict: LoadFS loaded a broken include")
+	}
+	conf, err := LoadFS(fsys, "config.yaml", LoadOptions{})
+	if err != nil {
+		t.Fatalf("lenient: LoadFS: %v", err)
+	}
+	if len(conf.Rules) != 1 || conf.Rules[0].Request.Path != "/good" {
+		t.Errorf("lenient: got %d rules, want only /good", len(conf.Rules))
+	}
+}
+
+// indent nests a rule list under a rules: key.
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n  ") + "\n"
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const CurrentVersion = 1
+
+// Duration accepts values like "30s" or "500ms" in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type RateLimitSettings struct {
+	// Enabled is true when left out and requests or window is set.
+	Enabled  *bool    `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Requests uint32   `yaml:"requests,omitempty" json:"requests,omitempty"`
+	Window   Duration `yaml:"window,omitempty" json:"window,omitempty"`
+}
+
+// IsEnabled reports whether s turns rate limiting on.
+func (s *RateLimitSettings) IsEnabled() bool {
+	if s.Enabled != nil {
+		return *s.Enabled
+	}
+	return s.Requests != 0 || s.Window != 0
+}
+
+type ServerSettings struct {
+	Host           string             `yaml:"host,omitempty" json:"host,omitempty"`
+	Port           uint16             `yaml:"port,omitempty" json:"port,omitempty"`
+	MaxRequestSize uint               `yaml:"max_request_size,omitempty" json:"max_request_size,omitempty"`
+	MaxHeaderSize  uint               `yaml:"max_header_size,omitempty" json:"max_header_size,omitempty"`
+	RequestTimeout Duration           `yaml:"request_timeout,omitempty" json:"request_timeout,omitempty"`
+	RateLimit      *RateLimitSettings `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+}
+
+// merge copies every field set in other over s.
+func (s *ServerSettings) merge(other *ServerSettings) {
+	if other == nil {
+		return
+	}
+	if other.Host != "" {
+		s.Host = other.Host
+	}
+	if other.Port != 0 {
+		s.Port = other.Port
+	}
+	if other.MaxRequestSize != 0 {
+		s.MaxRequestSize = other.MaxRequestSize
+	}
+	if other.MaxHeaderSize != 0 {
+		s.MaxHeaderSize = other.MaxHeaderSize
+	}
+	if other.RequestTimeout != 0 {
+		s.RequestTimeout = other.RequestTimeout
+	}
+	if other.RateLimit != nil {
+		s.RateLimit = other.RateLimit
+	}
+}
+
+type Defaults struct {
+	// Headers are added to every mock response that doesn't set them.
+	Headers map[string]any `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// ProxyHeaders are sent upstream by every proxy rule that doesn't set them.
+	ProxyHeaders map[string]string `yaml:"proxy_headers,omitempty" json:"proxy_headers,omitempty"`
+}
+
+func (d *Defaults) apply(r *Rule) {
+	if d == nil {
+		return
+	}
+	if r.Response != nil && len(d.Headers) > 0 {
+		if r.Response.Headers == nil {
+			r.Response.Headers = make(map[string]any)
+		}
+		for k, v := range d.Headers {
+			if _, ok := r.Response.Headers[k]; !ok {
+				r.Response.Headers[k] = v
+			}
+		}
+	}
+	if r.Proxy != nil && len(d.ProxyHeaders) > 0 {
+		if r.Proxy.Headers == nil {
+			r.Proxy.Headers = make(map[string]string)
+		}
+		for k, v := range d.ProxyHeaders {
+			if _, ok := r.Proxy.Headers[k]; !ok {
+				r.Proxy.Headers[k] = v
+			}
+		}
+	}
+}
+
+// Document is the top-level config file format.
+type Document struct {
+	Version  int             `yaml:"version,omitempty" json:"version,omitempty"`
+	Include  []string        `yaml:"include,omitempty" json:"include,omitempty"`
+	Server   *ServerSettings `yaml:"server,omitempty" json:"server,omitempty"`
+	Defaults *Defaults       `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// Vars are used by ${NAME} placeholders in this file and the files it
+	// includes. Environment variables take precedence.
+	Vars map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// Fragments hold values rules reuse through $ref or YAML anchors.
+	Fragments map[string]any      `yaml:"fragments,omitempty" json:"fragments,omitempty"`
+	Profiles  map[string]*Profile `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+	Rules     []Rule              `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Groups    []Group             `yaml:"groups,omitempty" json:"groups,omitempty"`
+}
+
+// isRuleList reports whether a file holds a legacy bare rule array.
+func isRuleList(data []byte, ext string) bool {
+	data, ext, err := toNative(data, ext)
+	if err != nil {
+		return false
+	}
+	switch ext {
+	case ".yaml", ".yml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return false
+		}
+		return len(node.Content) > 0 && node.Content[0].Kind == yaml.SequenceNode
+	case ".json":
+		trimmed := bytes.TrimSpace(data)
+		return len(trimmed) > 0 && trimmed[0] == '['
+	}
+	return false
+}
+
+// decodeInto decodes a config file into target. In strict mode unknown
+// fields are rejected.
+func decodeInto(data []byte, ext string, strict bool, target any) error {
+	if !slices.Contains(Extensions, ext) {
+		return fmt.Errorf("unsupported file extension: %s", ext)
+	}
+
+	// TOML is re-encoded from scratch, so positions in the converted text
+	// mean nothing to the user
+	positions := ext != ".toml"
+	data, ext, err := toNative(data, ext)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err == nil && hasRefs(&node, reflect.TypeOf(target)) {
+		return decodeRefs(&node, strict, positions, target)
+	}
+
+	if strict {
+		if err := checkStrict(data, target, positions); err != nil {
+			return err
+		}
+	}
+
+	if ext == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(target); err != nil {
+			return jsonPosition(data, err)
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(strict)
+	return dec.Decode(target)
+}
+
+// decodeRefs decodes a document that uses $ref. JSON is parsed as YAML so
+// both go through the same node tree.
+func decodeRefs(node *yaml.Node, strict, positions bool, target any) error {
+	if err := resolveRefs(node, reflect.TypeOf(target)); err != nil {
+		return &refError{err}
+	}
+	if strict {
+		if err := checkStrictNode(node, target, positions); err != nil {
+			return err
+		}
+	}
+	return node.Decode(target)
+}
+
+// decodeDocument decodes either a Document or a legacy bare rule array.
+func decodeDocument(data []byte, ext string, strict bool) (*Document, error) {
+	doc := &Document{}
+	var target any = doc
+	if isRuleList(data, ext) {
+		target = &doc.Rules
+	}
+
+	if err := decodeInto(data, ext, strict, target); err != nil {
+		return nil, err
+	}
+
+	if doc.Version != 0 && doc.Version != CurrentVersion {
+		return nil, fmt.Errorf("unsupported config version %d", doc.Version)
+	}
+	return doc, nil
+}
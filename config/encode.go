@@ -0,0 +1,44 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Encode writes v in the config format matching ext.
+func Encode(v any, ext string) ([]byte, error) {
+	switch ext {
+	case ".yaml", ".yml", "":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ".toml":
+		return encodeTOML(v)
+	case ".json", ".json5", ".jsonc":
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// EncodeRules writes rules as a bare rule list.
+func EncodeRules(rules []Rule, ext string) ([]byte, error) {
+	if rules == nil {
+		rules = []Rule{}
+	}
+	return Encode(rules, ext)
+}
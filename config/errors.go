@@ -0,0 +1,47 @@
+package config
+
+import "fmt"
+
+// NotFoundError is returned when a config file, directory or include
+// doesn't exist.
+type NotFoundError struct {
+	Path string
+	Err  error
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("config %q not found", e.Path)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned when a config file can't be decoded. Err may join
+// several UnknownFieldError values.
+type ParseError struct {
+	File string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to decode %q: %s", e.File, e.Err.Error())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// refError is returned for a $ref that can't be resolved. Unlike a
+// ParseError it isn't skipped in non-strict mode, the file parsed fine.
+type refError struct {
+	err error
+}
+
+func (e *refError) Error() string {
+	return e.err.Error()
+}
+
+func (e *refError) Unwrap() error {
+	return e.err
+}
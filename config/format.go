@@ -0,0 +1,326 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FormatOptions struct {
+	// SortRules orders rules by path, then method. This changes which rule
+	// wins between rules of equal priority and specificity.
+	SortRules bool
+}
+
+// methodOrder is the order SortRules puts methods of the same path in.
+var methodOrder = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+var bodyType = reflect.TypeFor[Body]()
+
+// Format rewrites a YAML or JSON config file in canonical form: keys in the
+// order of the config types, block style, minimal quoting and JSON bodies
+// pretty-printed. YAML comments, anchors and unknown keys are kept.
+func Format(data []byte, ext string, opts FormatOptions) ([]byte, error) {
+	switch ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("formatting %s files is not supported", ext)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+
+	var t reflect.Type = reflect.TypeFor[Document]()
+	if doc.Content[0].Kind == yaml.SequenceNode {
+		t = reflect.TypeFor[[]Rule]()
+	}
+	f := formatter{opts: opts, yaml: ext != ".json"}
+	f.format(doc.Content[0], t)
+
+	if ext == ".json" {
+		var buf bytes.Buffer
+		writeJSON(&buf, doc.Content[0])
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// IsConfig reports whether data decodes as a config document or a rule
+// list, so fmt can leave other JSON and YAML files in a config directory
+// alone.
+func IsConfig(data []byte, ext string) bool {
+	_, err := decodeDocument(data, ext, true)
+	return err == nil
+}
+
+type formatter struct {
+	opts FormatOptions
+	// yaml is false for JSON files, where styles and bodies are left alone
+	yaml bool
+}
+
+// format walks node against the Go type it decodes into.
+func (f *formatter) format(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		return
+	}
+	if f.yaml {
+		node.Style = 0
+	}
+
+	if t == bodyType {
+		f.formatBody(node)
+		return
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		switch t.Kind() {
+		case reflect.Struct:
+			f.formatStruct(node, t)
+		case reflect.Map:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				f.format(node.Content[i], reflect.TypeFor[string]())
+				f.format(node.Content[i+1], t.Elem())
+			}
+		default:
+			f.formatAny(node)
+		}
+	case yaml.SequenceNode:
+		elem := reflect.TypeFor[any]()
+		if t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		for _, item := range node.Content {
+			f.format(item, elem)
+		}
+		if f.opts.SortRules && elem == reflect.TypeFor[Rule]() {
+			sortRuleNodes(node)
+		}
+	}
+	if f.yaml {
+		keepLineComments(node)
+	}
+}
+
+// keepLineComments moves the trailing comment of a flow collection below
+// node, now written in block style, onto the line that starts it: the key
+// of a mapping value, or the first key of a mapping in a list. The encoder
+// would write it after the collection, next to whatever comes next.
+func keepLineComments(node *yaml.Node) {
+	moveTo := func(target, value *yaml.Node) {
+		if value.LineComment == "" || target.LineComment != "" {
+			return
+		}
+		if value.Kind != yaml.MappingNode && value.Kind != yaml.SequenceNode {
+			return
+		}
+		target.LineComment = value.LineComment
+		value.LineComment = ""
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			moveTo(node.Content[i], node.Content[i+1])
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.MappingNode && len(item.Content) > 0 {
+				moveTo(item.Content[0], item)
+			}
+		}
+	}
+}
+
+// formatAny resets styles below values with no config type.
+func (f *formatter) formatAny(node *yaml.Node) {
+	for _, child := range node.Content {
+		f.format(child, reflect.TypeFor[any]())
+	}
+}
+
+// formatStruct orders keys like the struct fields. $ref and merge keys go
+// first, unknown keys last in their original order.
+func (f *formatter) formatStruct(node *yaml.Node, t reflect.Type) {
+	order := make(map[string]int)
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		if name := yamlFieldName(t.Field(i)); name != "" {
+			order[name] = i
+			fields[name] = t.Field(i).Type
+		}
+	}
+
+	type pair struct{ key, value *yaml.Node }
+	pairs := make([]pair, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if f.yaml {
+			key.Style = 0
+		}
+		if ft, ok := fields[key.Value]; ok {
+			f.format(value, ft)
+		} else if key.Value != refKey && key.Tag != "!!merge" {
+			f.format(value, reflect.TypeFor[any]())
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+
+	rank := func(p pair) int {
+		if p.key.Value == refKey || p.key.Tag == "!!merge" {
+			return -1
+		}
+		if i, ok := order[p.key.Value]; ok {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(pairs, func(a, b pair) int {
+		return rank(a) - rank(b)
+	})
+
+	node.Content = node.Content[:0]
+	for _, p := range pairs {
+		node.Content = append(node.Content, p.key, p.value)
+	}
+}
+
+// formatBody pretty-prints string bodies holding a JSON object or array as
+// a literal block.
+func (f *formatter) formatBody(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode {
+		f.formatAny(node)
+		return
+	}
+	if !f.yaml || node.ShortTag() != "!!str" {
+		return
+	}
+	trimmed := strings.TrimSpace(node.Value)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(trimmed), "", "  "); err != nil {
+		return
+	}
+	node.Value = out.String()
+	if strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+}
+
+// ruleKey returns the path and method of a rule node.
+func ruleKey(node *yaml.Node) (string, string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	req := mappingValue(node, "request")
+	if req == nil {
+		return "", ""
+	}
+	path, method := "", ""
+	if v := mappingValue(req, "path"); v != nil {
+		path = v.Value
+	}
+	if v := mappingValue(req, "method"); v != nil {
+		method = v.Value
+	}
+	return path, method
+}
+
+func sortRuleNodes(node *yaml.Node) {
+	methodRank := func(m string) int {
+		if i := slices.Index(methodOrder, m); i >= 0 {
+			return i
+		}
+		return len(methodOrder)
+	}
+	slices.SortStableFunc(node.Content, func(a, b *yaml.Node) int {
+		pa, ma := ruleKey(a)
+		pb, mb := ruleKey(b)
+		// rules without a request stay at the end
+		if (pa == "") != (pb == "") {
+			if pa == "" {
+				return 1
+			}
+			return -1
+		}
+		if c := strings.Compare(pa, pb); c != 0 {
+			return c
+		}
+		return methodRank(ma) - methodRank(mb)
+	})
+}
+
+// writeJSON writes a node parsed from JSON back as compact JSON, keeping
+// key order.
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, node.Content[i].Value)
+			buf.WriteByte(':')
+			writeJSON(buf, node.Content[i+1])
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, item)
+		}
+		buf.WriteByte(']')
+	case yaml.AliasNode:
+		writeJSON(buf, node.Alias)
+	default:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(node.Value)
+		default:
+			writeJSONString(buf, node.Value)
+		}
+	}
+}
+
+// writeJSONString quotes s without escaping HTML characters.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends with a newline
+	buf.Truncate(buf.Len() - 1)
+}
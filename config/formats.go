@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Extensions lists every config file format apihub reads.
+var Extensions = []string{".yaml", ".yml", ".json", ".json5", ".jsonc", ".toml"}
+
+// toNative converts formats without their own decode path into JSON. YAML and
+// JSON are returned unchanged.
+func toNative(data []byte, ext string) ([]byte, string, error) {
+	switch ext {
+	case ".toml":
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, "", err
+		}
+		out, err := json.Marshal(doc)
+		return out, ".json", err
+	case ".json5", ".jsonc":
+		out, err := json5ToJSON(data)
+		return out, ".json", err
+	}
+	return data, ext, nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+func isHexDigit(r rune) bool {
+	return strings.ContainsRune("0123456789abcdefABCDEF", r)
+}
+
+// json5ToJSON rewrites JSON5 into plain JSON: comments and trailing commas
+// are blanked out, single-quoted strings and unquoted keys are quoted.
+// Newlines are kept so line numbers in errors still point at the source.
+func json5ToJSON(data []byte) ([]byte, error) {
+	src := []rune(string(data))
+	var out strings.Builder
+	// position in out of a comma that may turn out to be trailing
+	pendingComma := -1
+
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		switch {
+		case r == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				out.WriteRune('\n')
+			}
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				if src[i] == '\n' {
+					out.WriteRune('\n')
+				}
+				i++
+			}
+			if i+1 >= len(src) {
+				return nil, errors.New("unterminated block comment")
+			}
+			i++
+		case r == '"' || r == '\'':
+			quote := r
+			var s strings.Builder
+			i++
+			for ; i < len(src) && src[i] != quote; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case '\n':
+						// line continuation
+					case 'x':
+						if i+2 >= len(src) || !isHexDigit(src[i+1]) || !isHexDigit(src[i+2]) {
+							return nil, errors.New("invalid \\x escape")
+						}
+						s.WriteString(`\u00` + string(src[i+1:i+3]))
+						i += 2
+					case 'v':
+						s.WriteString(`\u000b`)
+					case '0':
+						s.WriteString(`\u0000`)
+					case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+						s.WriteRune('\\')
+						s.WriteRune(src[i])
+					default:
+						// any other escaped character is itself
+						s.WriteRune(src[i])
+					}
+					continue
+				}
+				if src[i] == '"' {
+					s.WriteString(`\"`)
+					continue
+				}
+				s.WriteRune(src[i])
+			}
+			if i >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			pendingComma = -1
+			out.WriteString(`"` + s.String() + `"`)
+		case r == ',':
+			pendingComma = out.Len()
+			out.WriteRune(',')
+		case r == '}' || r == ']':
+			if pendingComma >= 0 {
+				// drop the trailing comma
+				rest := out.String()
+				out.Reset()
+				out.WriteString(rest[:pendingComma] + " " + rest[pendingComma+1:])
+				pendingComma = -1
+			}
+			out.WriteRune(r)
+		case unicode.IsSpace(r):
+			out.WriteRune(r)
+		case isIdentStart(r):
+			start := i
+			for i+1 < len(src) && isIdentPart(src[i+1]) {
+				i++
+			}
+			word := string(src[start : i+1])
+			pendingComma = -1
+			switch word {
+			case "true", "false", "null":
+				out.WriteString(word)
+			case "Infinity", "NaN":
+				return nil, fmt.Errorf("%s is not supported", word)
+			default:
+				out.WriteString(`"` + word + `"`)
+			}
+		case r == '+':
+			// JSON has no explicit positive sign
+		case r == '0' && i+1 < len(src) && (src[i+1] == 'x' || src[i+1] == 'X'):
+			start := i + 2
+			i = start
+			for i < len(src) && isHexDigit(src[i]) {
+				i++
+			}
+			var n int64
+			if _, err := fmt.Sscanf(string(src[start:i]), "%x", &n); err != nil {
+				return nil, fmt.Errorf("invalid hex number")
+			}
+			i--
+			pendingComma = -1
+			fmt.Fprintf(&out, "%d", n)
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1]):
+			// the whole number at once, so an exponent isn't read as a key
+			start := i
+			for i+1 < len(src) && (unicode.IsDigit(src[i+1]) || src[i+1] == '.') {
+				i++
+			}
+			if i+1 < len(src) && (src[i+1] == 'e' || src[i+1] == 'E') {
+				j := i + 2
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && unicode.IsDigit(src[j]) {
+					for i = j; i+1 < len(src) && unicode.IsDigit(src[i+1]); i++ {
+					}
+				}
+			}
+			mantissa, exponent, hasExponent := strings.Cut(string(src[start:i+1]), "e")
+			if !hasExponent {
+				mantissa, exponent, hasExponent = strings.Cut(mantissa, "E")
+			}
+			// .5 becomes 0.5 and 1. becomes 1.0
+			if strings.HasPrefix(mantissa, ".") {
+				mantissa = "0" + mantissa
+			}
+			if strings.HasSuffix(mantissa, ".") {
+				mantissa += "0"
+			}
+			pendingComma = -1
+			out.WriteString(mantissa)
+			if hasExponent {
+				out.WriteString("e" + exponent)
+			}
+		default:
+			pendingComma = -1
+			out.WriteRune(r)
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// plainNumbers turns json.Number values into int64 or float64 so TOML
+// writes integers without a fraction.
+func plainNumbers(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if item == nil {
+				delete(val, k)
+				continue
+			}
+			val[k] = plainNumbers(item)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = plainNumbers(item)
+		}
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		f, _ := val.Float64()
+		return f
+	}
+	return v
+}
+
+func encodeTOML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	// TOML documents are tables, wrap bare rule lists
+	if list, ok := generic.([]any); ok {
+		generic = map[string]any{"rules": list}
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(plainNumbers(generic)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert re-encodes a config file in another format without resolving
+// includes, variables or defaults.
+func Convert(data []byte, fromExt, toExt string) ([]byte, error) {
+	doc, err := decodeDocument(data, fromExt, true)
+	if err != nil {
+		return nil, err
+	}
+	if isRuleList(data, fromExt) {
+		return Encode(doc.Rules, toExt)
+	}
+	return Encode(doc, toExt)
+}
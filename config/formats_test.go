@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON5ToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain json", in: `{"a": [1, 2]}`, want: `{"a": [1, 2]}`},
+		{name: "line comment", in: "{\"a\": 1 // one\n}", want: `{"a": 1}`},
+		{name: "block comment", in: `{/* x */ "a": 1}`, want: `{"a": 1}`},
+		{name: "trailing commas", in: `{"a": [1, 2,], "b": 3,}`, want: `{"a": [1, 2], "b": 3}`},
+		{name: "trailing comma before comment", in: "[1, // last\n]", want: `[1]`},
+		{name: "unquoted keys", in: `{a: 1, $b_2: 2}`, want: `{"a": 1, "$b_2": 2}`},
+		{name: "single quotes", in: `{'a': 'b'}`, want: `{"a": "b"}`},
+		{name: "double quote in single quotes", in: `['say "hi"']`, want: `["say \"hi\""]`},
+		{name: "escaped single quote", in: `['it\'s']`, want: `["it's"]`},
+		{name: "escapes kept", in: `['a\nb\u0041']`, want: `["a\nbA"]`},
+		{name: "line continuation", in: "['a\\\nb']", want: `["ab"]`},
+		{name: "url in string", in: `{url: "http://localhost:9000/a"}`, want: `{"url": "http://localhost:9000/a"}`},
+		{name: "url in single quotes", in: `{url: 'http://x//y'}`, want: `{"url": "http://x//y"}`},
+		{name: "comment markers in string", in: `["/* not */", "a // b"]`, want: `["/* not */", "a // b"]`},
+		{name: "comma in string", in: `["a,]", "b",]`, want: `["a,]", "b"]`},
+		{name: "literals", in: `[true, false, null]`, want: `[true, false, null]`},
+		{name: "hex", in: `[0x1F, 0XFF]`, want: `[31, 255]`},
+		{name: "plus sign", in: `[+1, +2.5]`, want: `[1, 2.5]`},
+		{name: "leading dot", in: `[.5, -.25]`, want: `[0.5, -0.25]`},
+		{name: "trailing dot", in: `[1., 2]`, want: `[1.0, 2]`},
+		{name: "decimal kept", in: `[10.5]`, want: `[10.5]`},
+		{name: "exponent", in: `[1e5]`, want: `[100000]`},
+		{name: "signed exponent", in: `[-2.5E-3, 2.5E+3]`, want: `[-0.0025, 2500]`},
+		{name: "exponent after dot", in: `{a: 1.e2, b: .5e1}`, want: `{"a": 100, "b": 5}`},
+		{name: "exponent in plain json", in: `{"n": 2.5E3}`, want: `{"n": 2500}`},
+		{name: "hex escape", in: `["\x41"]`, want: `["A"]`},
+		{name: "json5 escapes", in: `['\v\0\a']`, want: `["\u000b\u0000a"]`},
+		{name: "bad hex escape", in: `["\xZ1"]`, wantErr: true},
+		{name: "infinity", in: `[Infinity]`, wantErr: true},
+		{name: "nan", in: `[NaN]`, wantErr: true},
+		{name: "unterminated string", in: `["abc`, wantErr: true},
+		{name: "unterminated comment", in: `[1 /* abc`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := json5ToJSON([]byte(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("json5ToJSON(%q) = %s, want an error", tt.in, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("json5ToJSON(%q): %v", tt.in, err)
+			}
+			var got, want any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("json5ToJSON(%q) = %s, not JSON: %v", tt.in, out, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("json5ToJSON(%q) = %s, want %s", tt.in, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON5ToJSONKeepsLines(t *testing.T) {
+	in := "{\n  // comment\n  /* block\n     comment */\n  a: 'x',\n}\n"
+	out, err := json5ToJSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(out), "\n"), strings.Count(in, "\n"); got != want {
+		t.Errorf("json5ToJSON kept %d lines, want %d:\n%s", got, want, out)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		from, to string
+		contains []string
+	}{
+		{
+			name:     "json5 to yaml",
+			in:       "[{request: {path: '/a', method: 'GET'}, response: {status: 200, body: 'http://x//y'},}]",
+			from:     ".json5",
+			to:       ".yaml",
+			contains: []string{"path: /a", "body: http://x//y", "status: 200"},
+		},
+		{
+			name:     "yaml to toml",
+			in:       "rules:\n  - request: {path: /a, method: GET}\n    response: {status: 200}\n",
+			from:     ".yaml",
+			to:       ".toml",
+			contains: []string{"[[rules]]", `path = "/a"`, "status = 200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Convert([]byte(tt.in), tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("Convert output is missing %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// refKey marks a mapping that is replaced by a fragment.
+const refKey = "$ref"
+
+// mappingValue returns the value of key in a mapping node.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// refResolver replaces {$ref: name} mappings with a copy of the named
+// fragment. Keys next to $ref override the fragment's keys, the same way
+// YAML merge keys work.
+type refResolver struct {
+	fragments *yaml.Node
+	// stack holds the fragments being resolved, to detect cycles
+	stack []string
+}
+
+// noRefFields are free-form data where $ref is an ordinary key, keyed by
+// "Type.field". Values typed any, such as mock bodies, are never searched.
+var noRefFields = map[string]bool{
+	"Document.fragments":   true,
+	"BodyMatcher.jsonpath": true,
+}
+
+// refable reports whether a mapping decoded into t can be a $ref: config
+// structs and maps, not bodies or other free-form values.
+func refable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != bodyType
+	case reflect.Map:
+		return true
+	}
+	return false
+}
+
+// walkRefs calls fn for every mapping holding $ref where a config value of
+// type t or below it is decoded. It doesn't look inside those mappings.
+func walkRefs(node *yaml.Node, t reflect.Type, fn func(node, ref *yaml.Node, t reflect.Type) error) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if fields, ok := mappingForms[t]; ok {
+		t = fields
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := walkRefs(child, t, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for _, child := range node.Content {
+			if err := walkRefs(child, t.Elem(), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		if !refable(t) {
+			return nil
+		}
+		if ref := mappingValue(node, refKey); ref != nil {
+			return fn(node, ref, t)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			ft, ok := childType(t, node.Content[i].Value)
+			if !ok {
+				continue
+			}
+			if err := walkRefs(node.Content[i+1], ft, fn); err != nil {
+				return err
+			}
+		}
+	}
+	// aliases point at anchored nodes that are resolved where they are
+	// defined
+	return nil
+}
+
+// childType returns the type the value under key decodes into, false when
+// $ref isn't resolved there.
+func childType(t reflect.Type, key string) (reflect.Type, bool) {
+	if t.Kind() == reflect.Map {
+		return t.Elem(), true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if yamlFieldName(t.Field(i)) == key {
+			return t.Field(i).Type, !noRefFields[typeName(t)+"."+key]
+		}
+	}
+	return nil, false
+}
+
+// errHasRefs stops hasRefs at the first $ref.
+var errHasRefs = errors.New("has refs")
+
+// hasRefs reports whether a parsed document decoded into t uses $ref.
+func hasRefs(doc *yaml.Node, t reflect.Type) bool {
+	err := walkRefs(doc, t, func(_, _ *yaml.Node, _ reflect.Type) error {
+		return errHasRefs
+	})
+	return err == errHasRefs
+}
+
+// resolveRefs resolves every $ref in a parsed document decoded into t, in
+// place.
+func resolveRefs(doc *yaml.Node, t reflect.Type) error {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	r := &refResolver{fragments: mappingValue(root, "fragments")}
+	return walkRefs(doc, t, r.expand)
+}
+
+// lookup finds a fragment by name, or by a JSON pointer such as
+// #/fragments/errors/notFound.
+func (r *refResolver) lookup(ref string) (*yaml.Node, error) {
+	name := strings.TrimPrefix(ref, "#/fragments/")
+	if strings.HasPrefix(name, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q, refs must point into fragments", ref)
+	}
+
+	node := r.fragments
+	for _, part := range strings.Split(name, "/") {
+		if node == nil {
+			break
+		}
+		// JSON pointer escapes
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		node = mappingValue(node, part)
+	}
+	if node == nil {
+		return nil, fmt.Errorf("unknown fragment %q", ref)
+	}
+	return node, nil
+}
+
+// expand replaces a mapping holding $ref with the fragment merged with the
+// mapping's other keys, then resolves the refs in the result.
+func (r *refResolver) expand(node, ref *yaml.Node, t reflect.Type) error {
+	if ref.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d, column %d: $ref must be a string", ref.Line, ref.Column)
+	}
+	if slices.Contains(r.stack, ref.Value) {
+		return fmt.Errorf("line %d, column %d: $ref cycle: %s -> %s", ref.Line, ref.Column, strings.Join(r.stack, " -> "), ref.Value)
+	}
+	fragment, err := r.lookup(ref.Value)
+	if err != nil {
+		return fmt.Errorf("line %d, column %d: %v", ref.Line, ref.Column, err)
+	}
+	if fragment.Kind == yaml.AliasNode {
+		fragment = fragment.Alias
+	}
+	resolved := copyNode(fragment)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == refKey {
+			continue
+		}
+		if resolved.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d, column %d: fragment %q is not a mapping and can't be combined with other keys", ref.Line, ref.Column, ref.Value)
+		}
+		if existing := mappingValue(resolved, key.Value); existing != nil {
+			*existing = *value
+		} else {
+			resolved.Content = append(resolved.Content, key, value)
+		}
+	}
+
+	// a fragment may itself use $ref, the keys merged in above then
+	// override that one
+	r.stack = append(r.stack, ref.Value)
+	err = walkRefs(resolved, t, r.expand)
+	r.stack = r.stack[:len(r.stack)-1]
+	if err != nil {
+		return err
+	}
+	*node = *resolved
+	return nil
+}
+
+// copyNode deep copies a node so fragments can be changed per use.
+func copyNode(node *yaml.Node) *yaml.Node {
+	out := *node
+	out.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		out.Content[i] = copyNode(child)
+	}
+	return &out
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// AuthSettings lists the credentials a group accepts. A request passes when
+// it carries any of them.
+type AuthSettings struct {
+	// Bearer tokens accepted in the Authorization header.
+	Bearer []string `yaml:"bearer,omitempty" json:"bearer,omitempty"`
+	// Basic maps user names to passwords.
+	Basic map[string]string `yaml:"basic,omitempty" json:"basic,omitempty"`
+}
+
+// Group applies a path prefix and shared settings to the rules nested in
+// it. Groups are flattened while loading, each rule keeps a pointer to its
+// group for the settings that apply at request time.
+type Group struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Prefix is prepended to every rule path.
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	// Host is the host pattern of rules that don't set their own.
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// Headers are request header matchers every rule requires.
+	Headers map[string]Matcher `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// ResponseHeaders are added to every mock response that doesn't set them.
+	ResponseHeaders map[string]any `yaml:"response_headers,omitempty" json:"response_headers,omitempty"`
+	// ProxyURL is prepended to proxy urls that aren't absolute. A proxy
+	// without a url forwards to ProxyURL plus the rule path.
+	ProxyURL string `yaml:"proxy_url,omitempty" json:"proxy_url,omitempty"`
+	// RateLimit replaces the server rate limit for the group, enabled: false
+	// turns rate limiting off.
+	RateLimit *RateLimitSettings `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	// Auth requires credentials for every rule in the group.
+	Auth  *AuthSettings `yaml:"auth,omitempty" json:"auth,omitempty"`
+	Rules []Rule        `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// Label names a group in logs and errors.
+func (g *Group) Label() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return g.Prefix
+}
+
+// joinPath puts prefix in front of path. A path of / becomes the prefix
+// itself.
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return path
+	}
+	if path == "/" || path == "" {
+		return prefix
+	}
+	return prefix + "/" + strings.TrimPrefix(path, "/")
+}
+
+func (g *Group) apply(r *Rule) {
+	if r.Proxy != nil && g.ProxyURL != "" && !strings.Contains(r.Proxy.Url, "://") {
+		url := r.Proxy.Url
+		if url == "" && r.Request != nil {
+			url = r.Request.Path
+		}
+		r.Proxy.Url = strings.TrimSuffix(g.ProxyURL, "/") + "/" + strings.TrimPrefix(url, "/")
+	}
+	if r.Request != nil {
+		r.Request.Path = joinPath(g.Prefix, r.Request.Path)
+		if r.Request.Host == "" {
+			r.Request.Host = g.Host
+		}
+		if len(g.Headers) > 0 {
+			if r.Request.Headers == nil {
+				r.Request.Headers = make(map[string]Matcher)
+			}
+			for k, v := range g.Headers {
+				if _, ok := r.Request.Headers[k]; !ok {
+					r.Request.Headers[k] = v.clone()
+				}
+			}
+		}
+	}
+	if r.Response != nil && len(g.ResponseHeaders) > 0 {
+		if r.Response.Headers == nil {
+			r.Response.Headers = make(map[string]any)
+		}
+		for k, v := range g.ResponseHeaders {
+			if _, ok := r.Response.Headers[k]; !ok {
+				r.Response.Headers[k] = v
+			}
+		}
+	}
+	r.Group = g
+}
+
+// loadGroups flattens the groups of a file into rules. Group settings are
+// applied before the file defaults, so they win over them.
+func (l *loader) loadGroups(p string, groups []Group, defaults *Defaults) ([]Rule, error) {
+	var out []Rule
+	for i := range groups {
+		g := &groups[i]
+		rules := g.Rules
+		g.Rules = nil
+		// settings copied into the rules are interpolated with them, only
+		// the ones read from the group at request time are expanded here
+		if g.Auth != nil {
+			if err := expandValue(reflect.ValueOf(g.Auth).Elem(), l.vars); err != nil {
+				return nil, fmt.Errorf("%s: group %s: auth: %v", l.name(p), g.Label(), err)
+			}
+		}
+		for j := range rules {
+			g.apply(&rules[j])
+		}
+		if err := l.prepareRules(p, rules, defaults); err != nil {
+			return nil, err
+		}
+		out = append(out, rules...)
+	}
+	return out, nil
+}
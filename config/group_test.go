@@ -0,0 +1,96 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadGroups(t *testing.T) {
+	t.Setenv("APIHUB_TEST_TOKEN", "secret")
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte(`
+groups:
+  - name: v2
+    prefix: /api/v2
+    headers:
+      x-template: "$${LIT}"
+    response_headers:
+      x-literal: "$${LIT}"
+      x-token: "${APIHUB_TEST_TOKEN}"
+    auth:
+      bearer: ["${APIHUB_TEST_TOKEN}"]
+    rules:
+      - request: { path: /users, method: GET }
+        response: { status: 200 }
+      - request: { path: /orders, method: GET }
+        response: { status: 200 }
+`)},
+	}
+	conf, err := LoadFS(fsys, "config.yaml", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(conf.Rules))
+	}
+	for _, r := range conf.Rules {
+		if !strings.HasPrefix(r.Request.Path, "/api/v2/") {
+			t.Errorf("path = %q, want it under /api/v2", r.Request.Path)
+		}
+		if got := r.Response.Headers["x-literal"]; got != "${LIT}" {
+			t.Errorf("%s: x-literal = %v, want ${LIT}", r.Request.Path, got)
+		}
+		if got := r.Response.Headers["x-token"]; got != "secret" {
+			t.Errorf("%s: x-token = %v, want secret", r.Request.Path, got)
+		}
+		if m := r.Request.Headers["x-template"]; m.Equals == nil || *m.Equals != "${LIT}" {
+			t.Errorf("%s: x-template matcher = %+v, want ${LIT}", r.Request.Path, m)
+		}
+		if r.Group == nil || r.Group.Auth == nil || r.Group.Auth.Bearer[0] != "secret" {
+			t.Errorf("%s: group auth was not interpolated", r.Request.Path)
+		}
+	}
+}
+
+func TestLoadGroupsErrorNamesGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name: "response header",
+			config: `
+groups:
+  - name: billing
+    response_headers: { x-key: "${APIHUB_TEST_UNSET}" }
+    rules:
+      - request: { path: /a, method: GET }
+        response: { status: 200 }
+`,
+			want: "config.yaml: group billing rule 0: environment variable \"APIHUB_TEST_UNSET\" is not set",
+		},
+		{
+			name: "auth",
+			config: `
+groups:
+  - name: billing
+    auth: { bearer: ["${APIHUB_TEST_UNSET}"] }
+    rules:
+      - request: { path: /a, method: GET }
+        response: { status: 200 }
+`,
+			want: "config.yaml: group billing: auth: environment variable \"APIHUB_TEST_UNSET\" is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"config.yaml": {Data: []byte(tt.config)}}
+			_, err := LoadFS(fsys, "config.yaml", LoadOptions{})
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("LoadFS error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
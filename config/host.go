@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MatchHost reports whether the Host of a request matches pattern. A
+// pattern like *.example.com matches any subdomain of example.com but not
+// example.com itself. The port of host is ignored unless pattern has one.
+// Hosts compare case-insensitively.
+func MatchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if _, _, err := net.SplitHostPort(pattern); err != nil {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// checkHost reports a host pattern MatchHost can't use.
+func checkHost(pattern string) error {
+	if strings.ContainsAny(pattern, "/?#") {
+		return fmt.Errorf("host %q must be a host name without scheme or path", pattern)
+	}
+	name := pattern
+	if h, _, err := net.SplitHostPort(pattern); err == nil {
+		name = h
+	}
+	switch {
+	case strings.Contains(strings.TrimPrefix(name, "*."), "*"):
+		return fmt.Errorf("host %q can only use * as its first label, like *.example.com", pattern)
+	case name == "" || name == "*.":
+		return fmt.Errorf("host %q is empty", pattern)
+	}
+	return nil
+}
+
+// hostRank orders host patterns from exact to wildcard to none.
+func hostRank(pattern string) int {
+	switch {
+	case pattern == "":
+		return 0
+	case strings.HasPrefix(pattern, "*"):
+		return 1
+	}
+	return 2
+}
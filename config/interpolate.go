@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// placeholderRe also matches the $${...} escape, so it is skipped as a
+// whole.
+var placeholderRe = regexp.MustCompile(`\$?\$\{([^}]+)\}`)
+
+// expandString resolves ${VAR}, ${VAR:-default} and ${file:/path}
+// placeholders. VAR is looked up in the environment, then in vars. $${...}
+// is written as a literal ${...}.
+func expandString(s string, vars map[string]string) (string, error) {
+	var firstErr error
+	out := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		if escaped, ok := strings.CutPrefix(m, "$$"); ok {
+			return "$" + escaped
+		}
+		expr := m[2 : len(m)-1]
+
+		if path, ok := strings.CutPrefix(expr, "file:"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("reading secret %q: %v", path, err)
+				}
+				return m
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			val, ok = vars[name]
+		}
+		if hasDefault && val == "" {
+			return def
+		}
+		if ok {
+			return val
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("environment variable %q is not set", name)
+		}
+		return m
+	})
+	return out, firstErr
+}
+
+// expandRule interpolates every string field of the rule in place.
+func expandRule(r *Rule, vars map[string]string) error {
+	if err := expandValue(reflect.ValueOf(r).Elem(), vars); err != nil {
+		return ruleError(r, err)
+	}
+	return nil
+}
+
+func expandValue(v reflect.Value, vars map[string]string) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expandString(v.String(), vars)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values inside interfaces aren't addressable, copy and write back
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			if err := expandValue(elem, vars); err != nil {
+				return err
+			}
+			v.Set(elem)
+			return nil
+		}
+		return expandValue(v.Elem(), vars)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() || t.Field(i).Tag.Get("yaml") == "-" {
+				continue
+			}
+			if err := expandValue(v.Field(i), vars); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandValue(v.Index(i), vars); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := expandValue(elem, vars); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// expandVars resolves placeholders in a file's vars: section and adds them
+// to the vars inherited from the including file. Vars can use each other in
+// any order.
+func expandVars(own, inherited map[string]string) (map[string]string, error) {
+	vars := maps.Clone(inherited)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	done := make(map[string]bool)
+	resolving := make(map[string]bool)
+
+	var resolve func(name string) error
+	resolve = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		if resolving[name] {
+			return fmt.Errorf("vars.%s is part of a reference cycle", name)
+		}
+		resolving[name] = true
+		for _, m := range placeholderRe.FindAllStringSubmatch(own[name], -1) {
+			if strings.HasPrefix(m[0], "$$") {
+				continue
+			}
+			// ${name} inside name means the inherited value
+			dep, _, _ := strings.Cut(m[1], ":-")
+			if _, ok := own[dep]; ok && dep != name {
+				if err := resolve(dep); err != nil {
+					return err
+				}
+			}
+		}
+		val, err := expandString(own[name], vars)
+		if err != nil {
+			return fmt.Errorf("vars.%s: %v", name, err)
+		}
+		vars[name] = val
+		done[name] = true
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(own)) {
+		if err := resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
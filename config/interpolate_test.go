@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("APIHUB_TEST_HOST", "example.com")
+	t.Setenv("APIHUB_TEST_EMPTY", "")
+	secret := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"region": "eu", "APIHUB_TEST_HOST": "from-vars"}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "http://${APIHUB_TEST_HOST}/a", want: "http://example.com/a"},
+		{in: "${region}-${region}", want: "eu-eu"},
+		{in: "${APIHUB_TEST_UNSET:-fallback}", want: "fallback"},
+		{in: "${APIHUB_TEST_EMPTY:-fallback}", want: "fallback"},
+		{in: "${APIHUB_TEST_HOST:-fallback}", want: "example.com"},
+		{in: "${APIHUB_TEST_UNSET:-}", want: ""},
+		{in: "${APIHUB_TEST_UNSET:-a:-b}", want: "a:-b"},
+		{in: "Bearer ${file:" + secret + "}", want: "Bearer s3cret"},
+		{in: "$${APIHUB_TEST_HOST}", want: "${APIHUB_TEST_HOST}"},
+		{in: "$${APIHUB_TEST_UNSET}", want: "${APIHUB_TEST_UNSET}"},
+		{in: "$$${APIHUB_TEST_HOST}", want: "$${APIHUB_TEST_HOST}"},
+		{in: "$${a} ${region}", want: "${a} eu"},
+		{in: "cost: $5, ${region}", want: "cost: $5, eu"},
+		{in: "${}", want: "${}"},
+		{in: "${APIHUB_TEST_UNSET}", wantErr: `environment variable "APIHUB_TEST_UNSET" is not set`},
+		{in: "${file:/nonexistent/apihub-secret}", wantErr: "reading secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandString(tt.in, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandString(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandString(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("expandString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	t.Setenv("APIHUB_TEST_HOST", "example.com")
+	tests := []struct {
+		name      string
+		own       map[string]string
+		inherited map[string]string
+		want      map[string]string
+		wantErr   string
+	}{
+		{
+			name: "any order",
+			own:  map[string]string{"a": "${b}/a", "b": "${c}/b", "c": "c"},
+			want: map[string]string{"a": "c/b/a", "b": "c/b", "c": "c"},
+		},
+		{
+			name: "environment",
+			own:  map[string]string{"url": "http://${APIHUB_TEST_HOST}"},
+			want: map[string]string{"url": "http://example.com"},
+		},
+		{
+			name:      "inherited",
+			own:       map[string]string{"b": "${a}-b"},
+			inherited: map[string]string{"a": "a"},
+			want:      map[string]string{"a": "a", "b": "a-b"},
+		},
+		{
+			name:      "own name means the inherited value",
+			own:       map[string]string{"path": "${path}/v2"},
+			inherited: map[string]string{"path": "/api"},
+			want:      map[string]string{"path": "/api/v2"},
+		},
+		{
+			name: "escape is not a dependency",
+			own:  map[string]string{"a": "$${b}", "b": "${a}"},
+			want: map[string]string{"a": "${b}", "b": "${b}"},
+		},
+		{
+			name:    "cycle",
+			own:     map[string]string{"a": "${b}", "b": "${a}"},
+			wantErr: "part of a reference cycle",
+		},
+		{
+			name:    "unset",
+			own:     map[string]string{"a": "${APIHUB_TEST_UNSET}"},
+			wantErr: `vars.a: environment variable "APIHUB_TEST_UNSET" is not set`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVars(tt.own, tt.inherited)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandVars error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandVars: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandVars = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandRule(t *testing.T) {
+	t.Setenv("APIHUB_TEST_HOST", "example.com")
+	equals := "${APIHUB_TEST_HOST}"
+	r := Rule{
+		File: "config.yaml",
+		Request: &RequestRule{
+			Path:    "/${region}/items",
+			Headers: map[string]Matcher{"host": {Equals: &equals}},
+		},
+		Response: &MockResponse{
+			Headers: map[string]any{"x-region": "${region}", "x-count": 1},
+			Body: Body{Data: map[string]any{
+				"host":     "${APIHUB_TEST_HOST}",
+				"template": "$${user.name}",
+				"list":     []any{"${region}", 2},
+			}},
+		},
+	}
+	if err := expandRule(&r, map[string]string{"region": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Request.Path != "/eu/items" {
+		t.Errorf("path = %q", r.Request.Path)
+	}
+	if got := *r.Request.Headers["host"].Equals; got != "example.com" {
+		t.Errorf("header matcher = %q", got)
+	}
+	if got := r.Response.Headers["x-region"]; got != "eu" {
+		t.Errorf("response header = %v", got)
+	}
+	want := map[string]any{
+		"host":     "example.com",
+		"template": "${user.name}",
+		"list":     []any{"eu", 2},
+	}
+	if !reflect.DeepEqual(r.Response.Body.Data, want) {
+		t.Errorf("body = %v, want %v", r.Response.Body.Data, want)
+	}
+
+	r = Rule{File: "config.yaml", Index: 3, Response: &MockResponse{Body: Body{Text: "${APIHUB_TEST_UNSET}"}}}
+	err := expandRule(&r, nil)
+	if want := `config.yaml: rule 3: environment variable "APIHUB_TEST_UNSET" is not set`; err == nil || err.Error() != want {
+		t.Errorf("expandRule error = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one step of a JSONPath expression: a key, an array index or
+// a wildcard.
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the JSONPath subset body matchers support:
+// $.a.b, $['a b'], $.items[0], $.items[-1] and $.items[*].id.
+func parseJSONPath(expr string) ([]pathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid jsonpath %q: must start with $", expr)
+	}
+	var steps []pathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, fmt.Errorf("invalid jsonpath %q: empty key", expr)
+			}
+			steps = append(steps, pathStep{key: name, wildcard: name == "*"})
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid jsonpath %q: bad index %q", expr, inner)
+				}
+				steps = append(steps, pathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %q: unexpected %q", expr, rest[:1])
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns every value steps select in doc, a value decoded by
+// encoding/json.
+func evalJSONPath(steps []pathStep, doc any) []any {
+	nodes := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				switch {
+				case step.wildcard:
+					next = append(next, v...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
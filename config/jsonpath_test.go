@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []pathStep
+		wantErr bool
+	}{
+		{expr: "$", want: nil},
+		{expr: "$.user.id", want: []pathStep{{key: "user"}, {key: "id"}}},
+		{expr: " $.a ", want: []pathStep{{key: "a"}}},
+		{expr: "$['a b']", want: []pathStep{{key: "a b"}}},
+		{expr: `$["a.b"].c`, want: []pathStep{{key: "a.b"}, {key: "c"}}},
+		{expr: "$.items[0]", want: []pathStep{{key: "items"}, {index: 0, isIndex: true}}},
+		{expr: "$.items[-1]", want: []pathStep{{key: "items"}, {index: -1, isIndex: true}}},
+		{expr: "$.items[*].sku", want: []pathStep{{key: "items"}, {wildcard: true}, {key: "sku"}}},
+		{expr: "$.*", want: []pathStep{{key: "*", wildcard: true}}},
+		{expr: "$[ 2 ]", want: []pathStep{{index: 2, isIndex: true}}},
+		{expr: "a.b", wantErr: true},
+		{expr: "$.", wantErr: true},
+		{expr: "$..a", wantErr: true},
+		{expr: "$.a[0", wantErr: true},
+		{expr: "$.a[x]", wantErr: true},
+		{expr: "$a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseJSONPath(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseJSONPath(%q) = %+v, want an error", tt.expr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJSONPath(%q): %v", tt.expr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseJSONPath(%q) = %+v, want %+v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	const doc = `{
+		"user": {"id": 7, "name": "ann"},
+		"a b": true,
+		"items": [{"sku": "A1"}, {"sku": "B2"}, {"qty": 1}],
+		"tags": ["x", "y"]
+	}`
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want []any
+	}{
+		{expr: "$", want: []any{v}},
+		{expr: "$.user.id", want: []any{7.0}},
+		{expr: "$['a b']", want: []any{true}},
+		{expr: "$.items[0].sku", want: []any{"A1"}},
+		{expr: "$.items[-1].qty", want: []any{1.0}},
+		{expr: "$.items[*].sku", want: []any{"A1", "B2"}},
+		{expr: "$.tags[*]", want: []any{"x", "y"}},
+		{expr: "$.tags[5]", want: nil},
+		{expr: "$.tags[-3]", want: nil},
+		{expr: "$.missing.id", want: nil},
+		{expr: "$.user[0]", want: nil},
+		{expr: "$.tags.x", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			steps, err := parseJSONPath(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := evalJSONPath(steps, v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evalJSONPath(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+
+	// map order is random, so the wildcard results can come in any order
+	steps, _ := parseJSONPath("$.user.*")
+	got := evalJSONPath(steps, v)
+	if len(got) != 2 || !slices.Contains(got, any(7.0)) || !slices.Contains(got, any("ann")) {
+		t.Errorf("evalJSONPath($.user.*) = %v, want [7 ann] in any order", got)
+	}
+}
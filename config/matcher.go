@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matcher checks the values of a request field that may repeat, such as a
+// query parameter or a header. In config files a scalar is an exact match, a list
+// requires every listed value and a mapping sets the fields below. All
+// fields that are set must match, an empty matcher only requires the field
+// to be present.
+type Matcher struct {
+	// Equals matches when any value is exactly this.
+	Equals *string `yaml:"equals,omitempty" json:"equals,omitempty"`
+	// Regex matches when any value matches this regular expression.
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	// Contains matches when any value contains this text.
+	Contains string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	// Present only requires the field to be there.
+	Present bool `yaml:"present,omitempty" json:"present,omitempty"`
+	// Absent requires the field to be missing.
+	Absent bool `yaml:"absent,omitempty" json:"absent,omitempty"`
+	// All requires every listed value, in any order.
+	All []string `yaml:"all,omitempty" json:"all,omitempty"`
+	// IgnoreCase compares equals, regex, contains and all without regard
+	// to case.
+	IgnoreCase bool `yaml:"ignore_case,omitempty" json:"ignore_case,omitempty"`
+}
+
+// matcherFields is Matcher without its decoding methods. Strict mode checks
+// the mapping form against it.
+type matcherFields Matcher
+
+var matcherType = reflect.TypeFor[Matcher]()
+var matcherFieldsType = reflect.TypeFor[matcherFields]()
+
+// Exact returns a Matcher for one exact value.
+func Exact(value string) Matcher {
+	return Matcher{Equals: &value}
+}
+
+// clone returns a copy of m that shares no memory with it, so each rule
+// can interpolate its own copy of a shared matcher.
+func (m Matcher) clone() Matcher {
+	if m.Equals != nil {
+		equals := *m.Equals
+		m.Equals = &equals
+	}
+	m.All = slices.Clone(m.All)
+	return m
+}
+
+// regexCache holds compiled matcher regexes by pattern.
+var regexCache sync.Map
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// pattern returns the regex m.Regex compiles to.
+func (m *Matcher) pattern() string {
+	if m.IgnoreCase {
+		return "(?i)" + m.Regex
+	}
+	return m.Regex
+}
+
+func (m *Matcher) compile() error {
+	if m.Regex == "" {
+		return nil
+	}
+	_, err := compileRegex(m.pattern())
+	return err
+}
+
+// check reports a matcher that can never be satisfied as written.
+func (m Matcher) check() error {
+	if err := m.compile(); err != nil {
+		return err
+	}
+	if m.Absent && (m.Equals != nil || m.Regex != "" || m.Contains != "" || m.Present || m.All != nil) {
+		return errors.New("absent can't be combined with other matchers")
+	}
+	return nil
+}
+
+func (m *Matcher) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*m = Exact(node.Value)
+		return nil
+	case yaml.SequenceNode:
+		*m = Matcher{}
+		return node.Decode(&m.All)
+	case yaml.MappingNode:
+		var fields matcherFields
+		if err := node.Decode(&fields); err != nil {
+			return err
+		}
+		*m = Matcher(fields)
+		if err := m.compile(); err != nil {
+			return fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: matcher must be a value, a list or a mapping", node.Line)
+}
+
+func (m *Matcher) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case string(trimmed) == "null":
+		// like a YAML key with no value, only presence is required
+		*m = Matcher{}
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '"':
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return err
+		}
+		*m = Exact(s)
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		*m = Matcher{}
+		return json.Unmarshal(trimmed, &m.All)
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var fields matcherFields
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return err
+		}
+		*m = Matcher(fields)
+		return m.compile()
+	}
+	// numbers and booleans match their text
+	*m = Exact(string(trimmed))
+	return nil
+}
+
+// simple reports whether m is only an exact value or only a list, the
+// forms it is written back in.
+func (m Matcher) simple() (any, bool) {
+	if m.Regex != "" || m.Contains != "" || m.Present || m.Absent || m.IgnoreCase {
+		return nil, false
+	}
+	switch {
+	case m.Equals != nil && m.All == nil:
+		return *m.Equals, true
+	case m.Equals == nil && m.All != nil:
+		return m.All, true
+	}
+	return nil, false
+}
+
+func (m Matcher) MarshalYAML() (any, error) {
+	if v, ok := m.simple(); ok {
+		return v, nil
+	}
+	return matcherFields(m), nil
+}
+
+func (m Matcher) MarshalJSON() ([]byte, error) {
+	if v, ok := m.simple(); ok {
+		return json.Marshal(v)
+	}
+	return json.Marshal(matcherFields(m))
+}
+
+// Match reports whether values, the values of a field that is present or
+// not, satisfy m.
+func (m *Matcher) Match(values []string, present bool) bool {
+	if m.Absent {
+		return !present
+	}
+	if !present {
+		return false
+	}
+	equal := func(want string) func(string) bool {
+		return func(v string) bool {
+			if m.IgnoreCase {
+				return strings.EqualFold(v, want)
+			}
+			return v == want
+		}
+	}
+	if m.Equals != nil && !slices.ContainsFunc(values, equal(*m.Equals)) {
+		return false
+	}
+	if m.Regex != "" {
+		re, err := compileRegex(m.pattern())
+		if err != nil || !slices.ContainsFunc(values, re.MatchString) {
+			return false
+		}
+	}
+	if m.Contains != "" && !slices.ContainsFunc(values, func(v string) bool {
+		if m.IgnoreCase {
+			return strings.Contains(strings.ToLower(v), strings.ToLower(m.Contains))
+		}
+		return strings.Contains(v, m.Contains)
+	}) {
+		return false
+	}
+	for _, want := range m.All {
+		if !slices.ContainsFunc(values, equal(want)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher string
+		values  []string
+		present bool
+		want    bool
+	}{
+		{name: "exact", matcher: `v1`, values: []string{"v1"}, present: true, want: true},
+		{name: "exact mismatch", matcher: `v1`, values: []string{"v2"}, present: true, want: false},
+		{name: "exact any value", matcher: `v1`, values: []string{"v2", "v1"}, present: true, want: true},
+		{name: "exact missing", matcher: `v1`, present: false, want: false},
+		{name: "number", matcher: `2`, values: []string{"2"}, present: true, want: true},
+		{name: "exact is case sensitive", matcher: `abc`, values: []string{"ABC"}, present: true, want: false},
+		{name: "list needs all", matcher: `[a, b]`, values: []string{"b", "a"}, present: true, want: true},
+		{name: "list missing one", matcher: `[a, b]`, values: []string{"a"}, present: true, want: false},
+		{name: "empty matcher needs presence", matcher: `{}`, values: []string{""}, present: true, want: true},
+		{name: "empty matcher missing", matcher: `{}`, present: false, want: false},
+		{name: "present", matcher: `{present: true}`, values: []string{"x"}, present: true, want: true},
+		{name: "absent", matcher: `{absent: true}`, present: false, want: true},
+		{name: "absent but sent", matcher: `{absent: true}`, values: []string{""}, present: true, want: false},
+		{name: "regex", matcher: `{regex: "^(asc|desc)$"}`, values: []string{"asc"}, present: true, want: true},
+		{name: "regex mismatch", matcher: `{regex: "^(asc|desc)$"}`, values: []string{"up"}, present: true, want: false},
+		{name: "regex ignore case", matcher: `{regex: "^json$", ignore_case: true}`, values: []string{"JSON"}, present: true, want: true},
+		{name: "contains", matcher: `{contains: json}`, values: []string{"application/json"}, present: true, want: true},
+		{name: "contains case", matcher: `{contains: json}`, values: []string{"APPLICATION/JSON"}, present: true, want: false},
+		{name: "contains ignore case", matcher: `{contains: json, ignore_case: true}`, values: []string{"APPLICATION/JSON"}, present: true, want: true},
+		{name: "equals ignore case", matcher: `{equals: Bob, ignore_case: true}`, values: []string{"bob"}, present: true, want: true},
+		{name: "all ignore case", matcher: `{all: [A, b], ignore_case: true}`, values: []string{"a", "B"}, present: true, want: true},
+		{name: "fields combine", matcher: `{equals: a1, regex: "^a"}`, values: []string{"a1"}, present: true, want: true},
+		{name: "fields all must match", matcher: `{equals: a1, contains: z}`, values: []string{"a1"}, present: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Matcher
+			if err := yaml.Unmarshal([]byte(tt.matcher), &m); err != nil {
+				t.Fatalf("decoding %s: %v", tt.matcher, err)
+			}
+			if got := m.Match(tt.values, tt.present); got != tt.want {
+				t.Errorf("%s.Match(%q, %v) = %v, want %v", tt.matcher, tt.values, tt.present, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		json    string
+		want    any
+		wantErr bool
+	}{
+		{name: "string", yaml: `abc`, json: `"abc"`, want: "abc"},
+		{name: "number", yaml: `42`, json: `42`, want: "42"},
+		{name: "bool", yaml: `true`, json: `true`, want: "true"},
+		{name: "list", yaml: `[a, b]`, json: `["a","b"]`, want: []any{"a", "b"}},
+		{name: "mapping", yaml: `{regex: "^a"}`, json: `{"regex":"^a"}`, want: map[string]any{"regex": "^a"}},
+		{name: "null", yaml: `null`, json: `null`, want: map[string]any{}},
+		{name: "bad regex", yaml: `{regex: "("}`, json: `{"regex":"("}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromYAML, fromJSON Matcher
+			yamlErr := yaml.Unmarshal([]byte(tt.yaml), &fromYAML)
+			jsonErr := json.Unmarshal([]byte(tt.json), &fromJSON)
+			if tt.wantErr {
+				if yamlErr == nil || jsonErr == nil {
+					t.Fatalf("decoding = %v, %v, want errors", yamlErr, jsonErr)
+				}
+				return
+			}
+			if yamlErr != nil || jsonErr != nil {
+				t.Fatalf("decoding: %v, %v", yamlErr, jsonErr)
+			}
+			for _, m := range []Matcher{fromYAML, fromJSON} {
+				// the simple forms are written back as they were read
+				data, err := json.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, _ := json.Marshal(tt.want); string(data) != string(want) {
+					t.Errorf("encoded %s, want %s", data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMatcherCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher Matcher
+		wantErr bool
+	}{
+		{name: "absent", matcher: Matcher{Absent: true}},
+		{name: "absent and equals", matcher: Matcher{Absent: true, Equals: new(string)}, wantErr: true},
+		{name: "absent and present", matcher: Matcher{Absent: true, Present: true}, wantErr: true},
+		{name: "bad regex", matcher: Matcher{Regex: "["}, wantErr: true},
+		{name: "regex", matcher: Matcher{Regex: `^\d+$`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.matcher.check(); (err != nil) != tt.wantErr {
+				t.Errorf("check() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatcherNullMeansPresent(t *testing.T) {
+	var fromYAML, fromJSON map[string]Matcher
+	if err := yaml.Unmarshal([]byte("x-id:\n"), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"x-id": null}`), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	for name, headers := range map[string]map[string]Matcher{"yaml": fromYAML, "json": fromJSON} {
+		m, ok := headers["x-id"]
+		if !ok {
+			t.Fatalf("%s: x-id was not decoded", name)
+		}
+		if !m.Match([]string{"anything"}, true) {
+			t.Errorf("%s: null matcher doesn't match a present value", name)
+		}
+		if m.Match(nil, false) {
+			t.Errorf("%s: null matcher matches a missing value", name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// Label names a rule in logs and errors.
+func (r *Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if r.File != "" && r.Group != nil {
+		return fmt.Sprintf("%s group %s rule %d", r.File, r.Group.Label(), r.Index)
+	}
+	if r.File != "" {
+		return fmt.Sprintf("%s rule %d", r.File, r.Index)
+	}
+	if r.Request != nil {
+		return r.Request.Method + " " + r.Request.Path
+	}
+	return fmt.Sprintf("rule %d", r.Index)
+}
+
+func (r *Rule) HasAnyTag(tags []string) bool {
+	for _, t := range tags {
+		if slices.Contains(r.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterTags keeps only the rules that carry at least one of tags. An empty
+// list keeps every rule.
+func (c *Config) FilterTags(tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	c.Rules = slices.DeleteFunc(c.Rules, func(r Rule) bool {
+		return !r.HasAnyTag(tags)
+	})
+}
+
+// compareSpecificity orders paths by their first segment that differs in
+// kind: static text, then regex params, params, * wildcards, optional
+// params and catch-alls last. So /users/me comes before /users/:id and
+// /api/users before /api/**. Paths that are otherwise the same are ordered
+// by length to keep the ordering consistent.
+func compareSpecificity(a, b string) int {
+	pa, errA := compilePath(a)
+	pb, errB := compilePath(b)
+	if errA != nil || errB != nil {
+		return 0
+	}
+	for i := 0; i < min(len(pa.segments), len(pb.segments)); i++ {
+		if c := cmp.Compare(pa.segments[i].rank(), pb.segments[i].rank()); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(pa.segments), len(pb.segments))
+}
+
+// matcherCount counts the request matchers besides method and path.
+func (r *RequestRule) matcherCount() int {
+	n := len(r.Headers) + len(r.Query) + len(r.Cookies)
+	if r.Host != "" {
+		n++
+	}
+	if r.Body != nil {
+		n++
+	}
+	return n
+}
+
+// SortRules puts rules in matching order: higher priority first, then more
+// specific paths first, then rules with more host, header, query, cookie
+// and body matchers, then exact hosts before wildcards, then load order.
+func SortRules(rules []Rule) {
+	slices.SortStableFunc(rules, func(a, b Rule) int {
+		if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+			return c
+		}
+		if a.Request == nil || b.Request == nil {
+			return 0
+		}
+		if c := compareSpecificity(a.Request.Path, b.Request.Path); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Request.matcherCount(), a.Request.matcherCount()); c != 0 {
+			return c
+		}
+		return cmp.Compare(hostRank(b.Request.Host), hostRank(a.Request.Host))
+	})
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// CatchAll is the param name the tail matched by ** is captured under. A
+// proxy url uses it as ** too.
+const CatchAll = "**"
+
+type segmentKind int
+
+const (
+	segmentStatic segmentKind = iota
+	// segmentParam is :name or :name(regex), one segment
+	segmentParam
+	// segmentWildcard is *, one segment that isn't captured
+	segmentWildcard
+	// segmentCatchAll is ** or :name*, any number of segments
+	segmentCatchAll
+)
+
+type pathSegment struct {
+	kind  segmentKind
+	value string
+	name  string
+	re    *regexp.Regexp
+	// optional params may be left out of the request path
+	optional bool
+}
+
+// PathPattern is a parsed rule path. Segments are static text, :name
+// params, :name(regex) params that must match the regex, :name? optional
+// params, * for any single segment and ** or :name* for the rest of the
+// path, including nothing.
+type PathPattern struct {
+	segments []pathSegment
+}
+
+// paramNameRe leaves out the characters that carry meaning after a name.
+var paramNameRe = regexp.MustCompile(`^[^()*?]+$`)
+
+// ParsePath parses a rule path.
+func ParsePath(pattern string) (*PathPattern, error) {
+	p := &PathPattern{}
+	names := make(map[string]bool)
+	for _, part := range splitPath(pattern) {
+		seg, err := parseSegment(part)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", pattern, err)
+		}
+		if seg.name != "" {
+			if names[seg.name] {
+				return nil, fmt.Errorf("path %q: param %s is used twice", pattern, seg.name)
+			}
+			names[seg.name] = true
+		}
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+func parseSegment(part string) (pathSegment, error) {
+	switch part {
+	case "*":
+		return pathSegment{kind: segmentWildcard}, nil
+	case "**":
+		return pathSegment{kind: segmentCatchAll, name: CatchAll}, nil
+	}
+	rest, ok := strings.CutPrefix(part, ":")
+	if !ok {
+		return pathSegment{kind: segmentStatic, value: part}, nil
+	}
+
+	seg := pathSegment{kind: segmentParam}
+	if s, ok := strings.CutSuffix(rest, "*"); ok {
+		seg.kind = segmentCatchAll
+		rest = s
+	} else if s, ok := strings.CutSuffix(rest, "?"); ok {
+		seg.optional = true
+		rest = s
+	}
+	if open := strings.IndexByte(rest, '('); open >= 0 {
+		if seg.kind == segmentCatchAll || !strings.HasSuffix(rest, ")") {
+			return seg, fmt.Errorf("invalid param %q", part)
+		}
+		expr := rest[open+1 : len(rest)-1]
+		if _, err := compileRegex(expr); err != nil {
+			return seg, fmt.Errorf("param %q: %v", part, err)
+		}
+		// the regex has to match the whole segment
+		seg.re, _ = compileRegex("^(?:" + expr + ")$")
+		rest = rest[:open]
+	}
+	if !paramNameRe.MatchString(rest) {
+		return seg, fmt.Errorf("invalid param name in %q", part)
+	}
+	seg.name = rest
+	return seg, nil
+}
+
+// splitPath splits a path into segments, ignoring leading and trailing
+// slashes.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Match returns the captured params when path matches p. path is escaped,
+// like url.URL.EscapedPath returns it: segments are compared decoded, but
+// captured as sent, so an encoded / or ? stays inside its param. Optional
+// params that are left out are captured as "".
+func (p *PathPattern) Match(path string) (map[string]string, bool) {
+	params := make(map[string]string)
+	if !p.match(p.segments, splitPath(path), params) {
+		return nil, false
+	}
+	return params, true
+}
+
+// match captures params only on the way back from a full match, so failed
+// attempts leave nothing behind.
+func (p *PathPattern) match(segments []pathSegment, parts []string, params map[string]string) bool {
+	if len(segments) == 0 {
+		return len(parts) == 0
+	}
+	seg := &segments[0]
+	if seg.kind == segmentCatchAll {
+		// the longest tail that leaves a match for the segments after it
+		for n := len(parts); n >= 0; n-- {
+			if p.match(segments[1:], parts[n:], params) {
+				params[seg.name] = strings.Join(parts[:n], "/")
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) > 0 && seg.matches(parts[0]) && p.match(segments[1:], parts[1:], params) {
+		if seg.name != "" {
+			params[seg.name] = parts[0]
+		}
+		return true
+	}
+	if seg.optional && p.match(segments[1:], parts, params) {
+		params[seg.name] = ""
+		return true
+	}
+	return false
+}
+
+func (s *pathSegment) matches(part string) bool {
+	if decoded, err := url.PathUnescape(part); err == nil {
+		part = decoded
+	}
+	switch s.kind {
+	case segmentStatic:
+		return part == s.value
+	case segmentParam:
+		return s.re == nil || s.re.MatchString(part)
+	}
+	return true
+}
+
+// Params returns the names of the params p captures, in path order.
+func (p *PathPattern) Params() []string {
+	var names []string
+	for _, seg := range p.segments {
+		if seg.name != "" {
+			names = append(names, seg.name)
+		}
+	}
+	return names
+}
+
+// shape returns p with param names left out, so /users/:id and
+// /users/:uid have the same shape.
+func (p *PathPattern) shape() string {
+	parts := make([]string, len(p.segments))
+	for i, seg := range p.segments {
+		switch seg.kind {
+		case segmentStatic:
+			parts[i] = seg.value
+		case segmentParam:
+			parts[i] = ":"
+			if seg.re != nil {
+				parts[i] += "(" + seg.re.String() + ")"
+			}
+			if seg.optional {
+				parts[i] += "?"
+			}
+		case segmentWildcard:
+			parts[i] = "*"
+		case segmentCatchAll:
+			parts[i] = "**"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// rank orders segment kinds from the most specific to the least.
+func (s *pathSegment) rank() int {
+	switch {
+	case s.kind == segmentStatic:
+		return 0
+	case s.kind == segmentParam && s.re != nil && !s.optional:
+		return 1
+	case s.kind == segmentParam && !s.optional:
+		return 2
+	case s.kind == segmentWildcard:
+		return 3
+	case s.kind == segmentParam:
+		return 4
+	}
+	return 5
+}
+
+// pathCache holds parsed rule paths by pattern.
+var pathCache sync.Map
+
+// MatchPath reports whether an escaped request path matches a rule path and
+// returns the captured params, still escaped. Invalid patterns match
+// nothing.
+func MatchPath(pattern, path string) (map[string]string, bool) {
+	p, err := compilePath(pattern)
+	if err != nil {
+		return nil, false
+	}
+	return p.Match(path)
+}
+
+func compilePath(pattern string) (*PathPattern, error) {
+	if p, ok := pathCache.Load(pattern); ok {
+		return p.(*PathPattern), nil
+	}
+	p, err := ParsePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	pathCache.Store(pattern, p)
+	return p, nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  []string
+		wantErr bool
+	}{
+		{pattern: "/", params: nil},
+		{pattern: "/users/:id", params: []string{"id"}},
+		{pattern: `/users/:id(\d+)/posts/:post?`, params: []string{"id", "post"}},
+		{pattern: "/files/*/meta", params: nil},
+		{pattern: "/api/**", params: []string{CatchAll}},
+		{pattern: "/api/:rest*/edit", params: []string{"rest"}},
+		{pattern: "/a/:id/b/:id", wantErr: true},
+		{pattern: "/a/:rest(x)*", wantErr: true},
+		{pattern: "/a/:id(", wantErr: true},
+		{pattern: "/a/:id([)", wantErr: true},
+		{pattern: "/a/:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := ParsePath(tt.pattern)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePath(%q) = nil error, want one", tt.pattern)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePath(%q): %v", tt.pattern, err)
+			}
+			if got := p.Params(); !slices.Equal(got, tt.params) {
+				t.Errorf("Params() = %v, want %v", got, tt.params)
+			}
+		})
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    map[string]string
+	}{
+		{name: "static", pattern: "/users", path: "/users", want: map[string]string{}},
+		{name: "trailing slash", pattern: "/users", path: "/users/", want: map[string]string{}},
+		{name: "static mismatch", pattern: "/users", path: "/user"},
+		{name: "param", pattern: "/users/:id", path: "/users/42", want: map[string]string{"id": "42"}},
+		{name: "param needs a segment", pattern: "/users/:id", path: "/users"},
+		{name: "regex param", pattern: `/users/:id(\d+)`, path: "/users/42", want: map[string]string{"id": "42"}},
+		{name: "regex param mismatch", pattern: `/users/:id(\d+)`, path: "/users/me"},
+		{name: "regex matches whole segment", pattern: `/users/:id(\d+)`, path: "/users/42x"},
+		{name: "wildcard", pattern: "/files/*/meta", path: "/files/a.txt/meta", want: map[string]string{}},
+		{name: "wildcard is one segment", pattern: "/files/*/meta", path: "/files/a/b/meta"},
+
+		{name: "optional given", pattern: "/posts/:id?", path: "/posts/7", want: map[string]string{"id": "7"}},
+		{name: "optional left out", pattern: "/posts/:id?", path: "/posts", want: map[string]string{"id": ""}},
+		{name: "optional in the middle", pattern: "/a/:x?/b", path: "/a/b", want: map[string]string{"x": ""}},
+		{name: "optional before static", pattern: "/a/:x?/b", path: "/a/1/b", want: map[string]string{"x": "1"}},
+		{name: "optional regex left out", pattern: `/a/:x(\d+)?/:y`, path: "/a/z", want: map[string]string{"x": "", "y": "z"}},
+		{name: "two optionals", pattern: "/a/:x?/:y?", path: "/a/1", want: map[string]string{"x": "1", "y": ""}},
+
+		{name: "catch-all", pattern: "/api/**", path: "/api/a/b/c", want: map[string]string{CatchAll: "a/b/c"}},
+		{name: "catch-all empty", pattern: "/api/**", path: "/api", want: map[string]string{CatchAll: ""}},
+		{name: "named catch-all", pattern: "/api/:rest*", path: "/api/a/b", want: map[string]string{"rest": "a/b"}},
+		{name: "catch-all then static", pattern: "/api/**/edit", path: "/api/a/b/edit", want: map[string]string{CatchAll: "a/b"}},
+		{name: "catch-all then static empty", pattern: "/api/**/edit", path: "/api/edit", want: map[string]string{CatchAll: ""}},
+		{name: "catch-all then static mismatch", pattern: "/api/**/edit", path: "/api/a/b"},
+		{name: "catch-all is greedy", pattern: "/a/**/:last", path: "/a/b/c/d", want: map[string]string{CatchAll: "b/c", "last": "d"}},
+		{name: "catch-all backtracks to regex", pattern: `/a/**/:n(\d+)/x`, path: "/a/1/2/x/3/x", want: map[string]string{CatchAll: "1/2/x", "n": "3"}},
+		{name: "catch-all leaves nothing on failure", pattern: `/a/**/:n(\d+)`, path: "/a/b/c"},
+
+		{name: "encoded slash stays in segment", pattern: "/files/:name", path: "/files/a%2Fb", want: map[string]string{"name": "a%2Fb"}},
+		{name: "encoded query stays escaped", pattern: "/api/**", path: "/api/a%3Fadmin=1", want: map[string]string{CatchAll: "a%3Fadmin=1"}},
+		{name: "encoded hash stays escaped", pattern: "/t/:id/z", path: "/t/x%23y/z", want: map[string]string{"id": "x%23y"}},
+		{name: "static compares decoded", pattern: "/hello world", path: "/hello%20world", want: map[string]string{}},
+		{name: "regex compares decoded", pattern: "/tags/:tag(a b)", path: "/tags/a%20b", want: map[string]string{"tag": "a%20b"}},
+		{name: "invalid escape matches as sent", pattern: "/x/:v", path: "/x/100%", want: map[string]string{"v": "100%"}},
+
+		{name: "invalid pattern", pattern: "/a/:id(", path: "/a/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MatchPath(tt.pattern, tt.path)
+			if ok != (tt.want != nil) {
+				t.Fatalf("MatchPath(%q, %q) ok = %v, want %v", tt.pattern, tt.path, ok, tt.want != nil)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathShapeAndRank(t *testing.T) {
+	tests := []struct {
+		a, b      string
+		sameShape bool
+	}{
+		{a: "/users/:id", b: "/users/:uid", sameShape: true},
+		{a: `/users/:id(\d+)`, b: `/users/:uid(\d+)`, sameShape: true},
+		{a: "/users/:id", b: "/users/:id?", sameShape: false},
+		{a: "/api/**", b: "/api/:rest*", sameShape: true},
+		{a: "/files/*", b: "/files/:name", sameShape: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := ParsePath(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParsePath(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.shape() == b.shape(); got != tt.sameShape {
+				t.Errorf("same shape = %v (%s, %s), want %v", got, a.shape(), b.shape(), tt.sameShape)
+			}
+		})
+	}
+
+	p, err := ParsePath(`/static/:re(\d+)/:param/*/:opt?/**`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ranks []int
+	for i := range p.segments {
+		ranks = append(ranks, p.segments[i].rank())
+	}
+	if want := []int{0, 1, 2, 3, 4, 5}; !slices.Equal(ranks, want) {
+		t.Errorf("ranks = %v, want %v", ranks, want)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Profile is an overlay applied on top of the base rules, either from a
+// profiles: block or from a config.<profile>.yaml file.
+type Profile struct {
+	Server *ServerSettings `yaml:"server,omitempty" json:"server,omitempty"`
+	// Disable removes the named rules.
+	Disable []string `yaml:"disable,omitempty" json:"disable,omitempty"`
+	// Rules replace base rules with the same name, other rules are added.
+	Rules []Rule `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+func (c *Config) applyProfile(name string, p *Profile) error {
+	c.Server.merge(p.Server)
+
+	for _, disabled := range p.Disable {
+		idx := slices.IndexFunc(c.Rules, func(r Rule) bool { return r.Name == disabled })
+		if idx < 0 {
+			return fmt.Errorf("profile %q disables unknown rule %q", name, disabled)
+		}
+		c.Rules = slices.Delete(c.Rules, idx, idx+1)
+	}
+
+	for _, rule := range p.Rules {
+		idx := -1
+		if rule.Name != "" {
+			idx = slices.IndexFunc(c.Rules, func(r Rule) bool { return r.Name == rule.Name })
+		}
+		if idx >= 0 {
+			c.Rules[idx] = rule
+		} else {
+			c.Rules = append(c.Rules, rule)
+		}
+	}
+	return nil
+}
+
+// overlayPath finds config.<profile>.yaml next to config.yaml, or
+// rules.<profile>.yaml next to a rules directory.
+func (l *loader) overlayPath(base string, isDir bool, profile string) string {
+	if !isDir {
+		ext := path.Ext(base)
+		p := strings.TrimSuffix(base, ext) + "." + profile + ext
+		if _, err := fs.Stat(l.fsys, p); err == nil {
+			return p
+		}
+		return ""
+	}
+	for _, ext := range Extensions {
+		p := path.Clean(base) + "." + profile + ext
+		if _, err := fs.Stat(l.fsys, p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// loadOverlay reads a profile overlay file. Its rules see the vars and
+// defaults of the base file, so they read like rules written there.
+func (l *loader) loadOverlay(p string) (*Profile, error) {
+	l.files = append(l.files, l.name(p))
+
+	data, err := l.readFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{}
+	var target any = profile
+	if isRuleList(data, path.Ext(p)) {
+		target = &profile.Rules
+	}
+	if err := decodeInto(data, path.Ext(p), !l.opts.Lenient, target); err != nil {
+		return nil, &ParseError{File: l.name(p), Err: err}
+	}
+	l.vars = l.topVars
+	if err := l.prepareRules(p, profile.Rules, l.topDefaults); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
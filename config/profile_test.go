@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte(`vars:
+  upstream: http://staging.local
+defaults:
+  headers: { x-env: mock }
+rules:
+  - name: users
+    request: { path: /users, method: GET }
+    response: { status: 200 }
+`)},
+		"config.dev.yaml": {Data: []byte(`rules:
+  - name: users
+    request: { path: /users, method: GET }
+    proxy: { url: "${upstream}/users" }
+  - request: { path: /health, method: GET }
+    response: { status: 200 }
+`)},
+	}
+	conf, err := LoadFS(fsys, "config.yaml", LoadOptions{Profile: "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(conf.Rules))
+	}
+	if got := conf.Rules[0].Proxy; got == nil || got.Url != "http://staging.local/users" {
+		t.Errorf("overlay proxy = %+v, want the base file's var", got)
+	}
+	if got := conf.Rules[1].Response.Headers["x-env"]; got != "mock" {
+		t.Errorf("overlay response header = %v, want the base file's default", got)
+	}
+	if got := conf.Rules[1].File; got != "config.dev.yaml" {
+		t.Errorf("overlay rule file = %q", got)
+	}
+}
@@ -0,0 +1,400 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const SchemaID = "https://github.com/Cozzytree/apihub/config.schema.json"
+
+// refSchema is a mapping replaced by a fragment. Other keys next to $ref
+// override the fragment's keys, so they aren't checked here.
+var refSchema = map[string]any{
+	"type":     "object",
+	"required": []any{refKey},
+	"properties": map[string]any{
+		refKey: map[string]any{"type": "string", "description": "fragment name or #/fragments/... pointer"},
+	},
+}
+
+// matcherSchema is shared by header, query and form field matchers.
+var matcherSchema = map[string]any{
+	"description": "exact value, list of values that must all be present, or a matcher object",
+	"oneOf": []any{
+		refSchema,
+		map[string]any{"type": []any{"string", "number", "boolean", "null"}},
+		map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"equals":      map[string]any{"type": "string"},
+				"regex":       map[string]any{"type": "string", "format": "regex"},
+				"contains":    map[string]any{"type": "string"},
+				"present":     map[string]any{"type": "boolean"},
+				"absent":      map[string]any{"type": "boolean"},
+				"all":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"ignore_case": map[string]any{"type": "boolean"},
+			},
+		},
+	},
+}
+
+// typeSchemas covers types that decode themselves.
+var typeSchemas = map[reflect.Type]map[string]any{
+	reflect.TypeFor[Body](): {
+		"description": "response body, either a string or a structured value serialized by body_format",
+		"type":        []any{"string", "number", "boolean", "object", "array"},
+	},
+	reflect.TypeFor[Matcher](): matcherSchema,
+	reflect.TypeFor[BodyMatcher](): {
+		"description": "exact body or a body matcher object",
+		"oneOf": []any{
+			refSchema,
+			map[string]any{"type": "string"},
+			map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"equals":   map[string]any{"type": "string"},
+					"regex":    map[string]any{"type": "string", "format": "regex"},
+					"json":     map[string]any{"type": []any{"string", "number", "boolean", "null", "object", "array"}},
+					"jsonpath": map[string]any{"type": "object"},
+					"form":     map[string]any{"type": "object", "additionalProperties": matcherSchema},
+				},
+			},
+		},
+	},
+	reflect.TypeFor[Duration](): {
+		"description": "duration such as 500ms, 30s or 2m",
+		"type":        "string",
+		"pattern":     `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+	},
+}
+
+// fieldSchemas adds constraints to individual fields, keyed by "Type.field".
+var fieldSchemas = map[string]map[string]any{
+	"RequestRule.method": {
+		"enum": []any{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"},
+	},
+	"MockResponse.body_format": {
+		"enum": []any{"json", "xml", "yaml", "form"},
+	},
+}
+
+// structSchemas adds object level constraints, keyed by type name.
+var structSchemas = map[string]map[string]any{
+	"Rule": {
+		"required": []any{"request"},
+		"oneOf": []any{
+			map[string]any{"required": []any{"response"}},
+			map[string]any{"required": []any{"proxy"}},
+		},
+	},
+	"RequestRule": {"required": []any{"path", "method"}},
+}
+
+type schemaBuilder struct {
+	defs map[string]any
+}
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := typeSchemas[t]; ok {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := map[string]any{"type": "integer", "minimum": 0}
+		if t.Bits() < 64 {
+			s["maximum"] = uint64(1)<<t.Bits() - 1
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := b.defs[t.Name()]; ok {
+			return ref
+		}
+		// reserve the name first so recursive types terminate
+		b.defs[t.Name()] = nil
+
+		props := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			name := yamlFieldName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			prop := b.schemaFor(t.Field(i).Type)
+			if extra, ok := fieldSchemas[t.Name()+"."+name]; ok {
+				prop = mergeSchema(prop, extra)
+			}
+			props[name] = prop
+		}
+		def := map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if extra, ok := structSchemas[t.Name()]; ok {
+			def = mergeSchema(def, extra)
+		}
+		// objects below the document can come from a fragment
+		if t != reflect.TypeFor[Document]() && refable(t) {
+			def = map[string]any{"oneOf": []any{refSchema, def}}
+		}
+		b.defs[t.Name()] = def
+		return ref
+	}
+	return map[string]any{}
+}
+
+func mergeSchema(base, extra map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(extra))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
+
+// Schema returns a JSON Schema for config files, generated from the Go types.
+func Schema() map[string]any {
+	b := &schemaBuilder{defs: make(map[string]any)}
+	rules := b.schemaFor(reflect.TypeFor[[]Rule]())
+	doc := b.schemaFor(reflect.TypeFor[Document]())
+
+	return map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     SchemaID,
+		"title":   "apihub config",
+		"oneOf":   []any{rules, doc},
+		"$defs":   b.defs,
+	}
+}
+
+// SchemaJSON returns the schema as indented JSON.
+func SchemaJSON() ([]byte, error) {
+	return json.MarshalIndent(Schema(), "", "  ")
+}
+
+// CheckSchema validates a config file against Schema and returns every
+// violation found.
+func CheckSchema(path string) ([]error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ext, err := toNative(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+
+	var target reflect.Type = reflect.TypeFor[Document]()
+	if isRuleList(data, ext) {
+		target = reflect.TypeFor[[]Rule]()
+	}
+	var value any
+	var node yaml.Node
+	switch {
+	case yaml.Unmarshal(data, &node) == nil && hasRefs(&node, target):
+		// check the rules as they are after fragments are filled in
+		if err = resolveRefs(&node, target); err == nil {
+			err = node.Decode(&value)
+		}
+	case ext == ".json":
+		err = json.Unmarshal(data, &value)
+	default:
+		err = yaml.Unmarshal(data, &value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+
+	schema := Schema()
+	v := schemaValidator{defs: schema["$defs"].(map[string]any)}
+	var errs []error
+	for _, msg := range v.validate(schema, value, "$") {
+		errs = append(errs, fmt.Errorf("%s: %s", path, msg))
+	}
+	return errs, nil
+}
+
+// schemaValidator understands the subset of JSON Schema that Schema emits.
+type schemaValidator struct {
+	defs map[string]any
+}
+
+func (v schemaValidator) resolve(schema map[string]any) map[string]any {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, _ := v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		return def
+	}
+	return schema
+}
+
+func (v schemaValidator) validate(schema map[string]any, value any, path string) []string {
+	schema = v.resolve(schema)
+
+	var errs []string
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return []string{fmt.Sprintf("%s: expected %v, got %s", path, t, jsonType(value))}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if s, ok := value.(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			errs = append(errs, fmt.Sprintf("%s: %q does not match %s", path, s, pattern))
+		}
+	}
+	if n, ok := toFloat(value); ok {
+		if min, ok := toFloat(schema["minimum"]); ok && n < min {
+			errs = append(errs, fmt.Sprintf("%s: %v is below %v", path, value, schema["minimum"]))
+		}
+		if max, ok := toFloat(schema["maximum"]); ok && n > max {
+			errs = append(errs, fmt.Sprintf("%s: %v is above %v", path, value, schema["maximum"]))
+		}
+	}
+
+	if obj, ok := value.(map[string]any); ok {
+		props, _ := schema["properties"].(map[string]any)
+		for _, key := range sortedKeys(obj) {
+			childPath := path + "." + key
+			if prop, ok := props[key].(map[string]any); ok {
+				errs = append(errs, v.validate(prop, obj[key], childPath)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unknown field", childPath))
+				}
+			case map[string]any:
+				errs = append(errs, v.validate(extra, obj[key], childPath)...)
+			}
+		}
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if _, ok := obj[r.(string)]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: missing required field %q", path, r))
+				}
+			}
+		}
+	}
+
+	if arr, ok := value.([]any); ok {
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range arr {
+				errs = append(errs, v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		var best []string
+		for _, option := range oneOf {
+			optSchema := v.resolve(option.(map[string]any))
+			optErrs := v.validate(optSchema, value, path)
+			if len(optErrs) == 0 {
+				matched++
+				continue
+			}
+			// report the errors of the alternative with the right shape
+			t, hasType := optSchema["type"]
+			if best == nil || !hasType || matchesType(t, value) {
+				best = optErrs
+			}
+		}
+		switch {
+		case matched == 0:
+			errs = append(errs, best...)
+		case matched > 1:
+			errs = append(errs, fmt.Sprintf("%s: matches more than one alternative", path))
+		}
+	}
+
+	return errs
+}
+
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		if n, ok := toFloat(val); ok {
+			if n == math.Trunc(n) {
+				return "integer"
+			}
+			return "number"
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesType(t any, value any) bool {
+	actual := jsonType(value)
+	check := func(name string) bool {
+		return name == actual || (name == "number" && actual == "integer")
+	}
+	switch tt := t.(type) {
+	case string:
+		return check(tt)
+	case []any:
+		for _, name := range tt {
+			if check(name.(string)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(value any) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
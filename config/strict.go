@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlUnmarshaler = reflect.TypeFor[yaml.Unmarshaler]()
+
+// mappingForms maps types that decode themselves to the type their mapping
+// form is checked against.
+var mappingForms = map[reflect.Type]reflect.Type{
+	matcherType:     matcherFieldsType,
+	bodyMatcherType: bodyMatcherFieldsType,
+}
+
+// typeName names t in errors, using the public name for mapping forms.
+func typeName(t reflect.Type) string {
+	for public, fields := range mappingForms {
+		if fields == t {
+			return public.Name()
+		}
+	}
+	return t.Name()
+}
+
+// yamlFieldName returns the key a struct field is decoded from, or "" when
+// the field is skipped.
+func yamlFieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+type UnknownFieldError struct {
+	Line   int
+	Column int
+	Field  string
+	Type   string
+}
+
+func (e UnknownFieldError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("unknown field %q in %s", e.Field, e.Type)
+	}
+	return fmt.Sprintf("line %d, column %d: unknown field %q in %s", e.Line, e.Column, e.Field, e.Type)
+}
+
+// unknownFields walks a parsed document against the Go type it will be
+// decoded into and reports every key that doesn't map to a field.
+func unknownFields(node *yaml.Node, t reflect.Type) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if fields, ok := mappingForms[t]; ok && node.Kind == yaml.MappingNode {
+		t = fields
+	}
+	if reflect.PointerTo(t).Implements(yamlUnmarshaler) {
+		return nil
+	}
+
+	var errs []error
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			if name := yamlFieldName(t.Field(i)); name != "" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				// <<: *base or <<: [*a, *b]
+				if val.Kind == yaml.SequenceNode {
+					for _, item := range val.Content {
+						errs = append(errs, unknownFields(item, t)...)
+					}
+				} else {
+					errs = append(errs, unknownFields(val, t)...)
+				}
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, UnknownFieldError{
+					Line:   key.Line,
+					Column: key.Column,
+					Field:  key.Value,
+					Type:   typeName(t),
+				})
+				continue
+			}
+			errs = append(errs, unknownFields(val, ft)...)
+		}
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				errs = append(errs, unknownFields(item, t.Elem())...)
+			}
+		}
+	case reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				errs = append(errs, unknownFields(node.Content[i], t.Elem())...)
+			}
+		}
+	}
+	return errs
+}
+
+// checkStrict reports unknown fields, with their position unless positions
+// is false. JSON documents are parsed as YAML to recover line and column
+// numbers.
+func checkStrict(data []byte, target any, positions bool) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		// the real decoder will report the syntax error
+		return nil
+	}
+	return checkStrictNode(&node, target, positions)
+}
+
+func checkStrictNode(node *yaml.Node, target any, positions bool) error {
+	errs := unknownFields(node, reflect.TypeOf(target))
+	if !positions {
+		for i, err := range errs {
+			if unknown, ok := err.(UnknownFieldError); ok {
+				unknown.Line, unknown.Column = 0, 0
+				errs[i] = unknown
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// jsonPosition adds line and column numbers to JSON syntax errors.
+func jsonPosition(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var offset int64
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	line, col := 1, 1
+	for _, b := range data[:min(int(offset), len(data))] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Errorf("line %d, column %d: %v", line, col, err)
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+type ValidationError struct {
+	File    string
+	Group   string
+	Index   int
+	Name    string
+	Message string
+}
+
+func (v ValidationError) Error() string {
+	if v.Group != "" {
+		if v.Name != "" {
+			return fmt.Sprintf("%s: group %s rule %d (%s): %s", v.File, v.Group, v.Index, v.Name, v.Message)
+		}
+		return fmt.Sprintf("%s: group %s rule %d: %s", v.File, v.Group, v.Index, v.Message)
+	}
+	if v.Name != "" {
+		return fmt.Sprintf("%s: rule %d (%s): %s", v.File, v.Index, v.Name, v.Message)
+	}
+	return fmt.Sprintf("%s: rule %d: %s", v.File, v.Index, v.Message)
+}
+
+// ValidationErrors is returned by Load when LoadOptions.Validate is set and
+// the rules have problems.
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks every rule and returns all problems found.
+func (c *Config) Validate() []ValidationError {
+	var errs []ValidationError
+	seen := make(map[string]*Rule)
+	names := make(map[string]*Rule)
+
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		group := ""
+		if r.Group != nil {
+			group = r.Group.Label()
+		}
+		fail := func(format string, args ...any) {
+			errs = append(errs, ValidationError{
+				File:    r.File,
+				Group:   group,
+				Index:   r.Index,
+				Name:    r.Name,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if r.Name != "" {
+			if prev, ok := names[r.Name]; ok {
+				fail("name is already used by %s rule %d", prev.File, prev.Index)
+			} else {
+				names[r.Name] = r
+			}
+		}
+
+		if r.Request == nil {
+			fail("missing request")
+		} else {
+			if !validMethods[r.Request.Method] {
+				fail("invalid method %q", r.Request.Method)
+			}
+			if !strings.HasPrefix(r.Request.Path, "/") {
+				fail("path %q must start with /", r.Request.Path)
+			}
+			if _, err := compilePath(r.Request.Path); err != nil {
+				fail("%v", err)
+			}
+			for _, name := range slices.Sorted(maps.Keys(r.Request.Headers)) {
+				if err := r.Request.Headers[name].check(); err != nil {
+					fail("header %s: %v", name, err)
+				}
+			}
+			for _, name := range slices.Sorted(maps.Keys(r.Request.Query)) {
+				if err := r.Request.Query[name].check(); err != nil {
+					fail("query %s: %v", name, err)
+				}
+			}
+			for _, name := range slices.Sorted(maps.Keys(r.Request.Cookies)) {
+				if err := r.Request.Cookies[name].check(); err != nil {
+					fail("cookie %s: %v", name, err)
+				}
+			}
+			if r.Request.Host != "" {
+				if err := checkHost(r.Request.Host); err != nil {
+					fail("%v", err)
+				}
+			}
+			if b := r.Request.Body; b != nil {
+				if err := b.compile(); err != nil {
+					fail("body: %v", err)
+				}
+				if b.Equals == nil && b.Regex == "" && b.JSON == nil && len(b.JSONPath) == 0 && len(b.Form) == 0 {
+					fail("body matcher is empty")
+				}
+				if b.JSON != nil {
+					if _, err := json.Marshal(b.JSON); err != nil {
+						fail("body json: %v", err)
+					}
+				}
+			}
+		}
+
+		switch {
+		case r.Response == nil && r.Proxy == nil:
+			fail("rule needs either response or proxy")
+		case r.Response != nil && r.Proxy != nil:
+			fail("rule can't have both response and proxy")
+		}
+
+		if res := r.Response; res != nil && res.BodyFile != "" {
+			if res.Body.Text != "" {
+				fail("response can't have both body and body_file")
+			}
+			if info, err := c.stat(res.BodyFile); err != nil {
+				fail("body_file: %v", err)
+			} else if info.IsDir() {
+				fail("body_file %q is a directory", res.BodyFile)
+			}
+		}
+
+		if g := r.Group; g != nil && g.Auth != nil && len(g.Auth.Bearer) == 0 && len(g.Auth.Basic) == 0 {
+			fail("group auth needs bearer tokens or basic credentials")
+		}
+
+		if r.Proxy != nil {
+			u, err := url.Parse(r.Proxy.Url)
+			if err != nil {
+				fail("invalid proxy url %q: %v", r.Proxy.Url, err)
+			} else if u.Scheme == "" || u.Host == "" {
+				fail("proxy url %q must be absolute", r.Proxy.Url)
+			} else if r.Request != nil {
+				params := pathParams(r.Request.Path)
+				for name := range r.Request.Query {
+					params[name] = true
+				}
+				for _, p := range strings.Split(u.Path, "/") {
+					if p == CatchAll && !params[CatchAll] {
+						fail("proxy url uses ** but path %q has no **", r.Request.Path)
+					}
+					if name, ok := strings.CutPrefix(p, ":"); ok && !params[name] {
+						fail("proxy url uses :%s which is not defined in path %q or query", name, r.Request.Path)
+					}
+				}
+			}
+		}
+
+		if r.Request != nil {
+			headers, _ := json.Marshal(r.Request.Headers)
+			query, _ := json.Marshal(r.Request.Query)
+			cookies, _ := json.Marshal(r.Request.Cookies)
+			body, _ := json.Marshal(r.Request.Body)
+			key := r.Request.Method + " " + strings.ToLower(r.Request.Host) + normalizePath(r.Request.Path) + " " + string(headers) + " " + string(query) + " " + string(cookies) + " " + string(body)
+			if prev, ok := seen[key]; ok {
+				fail("duplicate of %s (%s %s%s)", prev.Label(), r.Request.Method, r.Request.Host, r.Request.Path)
+			} else {
+				seen[key] = r
+			}
+		}
+	}
+
+	return errs
+}
+
+func (c *Config) stat(name string) (fs.FileInfo, error) {
+	if c.FS != nil {
+		return fs.Stat(c.FS, name)
+	}
+	return os.Stat(name)
+}
+
+// pathParams returns the params a path captures, nil when the path is
+// invalid.
+func pathParams(path string) map[string]bool {
+	params := make(map[string]bool)
+	if p, err := compilePath(path); err == nil {
+		for _, name := range p.Params() {
+			params[name] = true
+		}
+	}
+	return params
+}
+
+// normalizePath replaces param names so /users/:id and /users/:uid compare equal.
+func normalizePath(path string) string {
+	p, err := compilePath(path)
+	if err != nil {
+		return path
+	}
+	return p.shape()
+}
@@ -0,0 +1,267 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+type Schema struct {
+	Type       string             `yaml:"type,omitempty" json:"type,omitempty"`
+	Format     string             `yaml:"format,omitempty" json:"format,omitempty"`
+	Properties map[string]*Schema `yaml:"properties,omitempty" json:"properties,omitempty"`
+	Items      *Schema            `yaml:"items,omitempty" json:"items,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `yaml:"name" json:"name"`
+	In       string  `yaml:"in" json:"in"`
+	Required bool    `yaml:"required" json:"required"`
+	Schema   *Schema `yaml:"schema" json:"schema"`
+	Example  any     `yaml:"example,omitempty" json:"example,omitempty"`
+}
+
+type MediaType struct {
+	Schema  *Schema `yaml:"schema" json:"schema"`
+	Example any     `yaml:"example,omitempty" json:"example,omitempty"`
+}
+
+type Response struct {
+	Description string               `yaml:"description" json:"description"`
+	Content     map[string]MediaType `yaml:"content,omitempty" json:"content,omitempty"`
+}
+
+type Operation struct {
+	Summary    string              `yaml:"summary,omitempty" json:"summary,omitempty"`
+	Parameters []Parameter         `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	Responses  map[string]Response `yaml:"responses" json:"responses"`
+}
+
+type Info struct {
+	Title   string `yaml:"title" json:"title"`
+	Version string `yaml:"version" json:"version"`
+}
+
+type Document struct {
+	OpenAPI string                           `yaml:"openapi" json:"openapi"`
+	Info    Info                             `yaml:"info" json:"info"`
+	Paths   map[string]map[string]*Operation `yaml:"paths" json:"paths"`
+}
+
+// paramsToTemplate turns /users/:id into /users/{id} and returns the param
+// names. Regexes and the optional mark are dropped, * becomes {wildcardN}
+// and a catch-all {path}, as OpenAPI params are single required segments.
+func paramsToTemplate(path string) (string, []string) {
+	var names []string
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		name, ok := strings.CutPrefix(part, ":")
+		switch {
+		case part == "*":
+			name, ok = fmt.Sprintf("wildcard%d", i), true
+		case part == config.CatchAll:
+			name, ok = "path", true
+		case ok:
+			if open := strings.IndexByte(name, '('); open >= 0 {
+				name = name[:open]
+			}
+			name = strings.TrimRight(name, "?*")
+		}
+		if ok {
+			parts[i] = "{" + name + "}"
+			names = append(names, name)
+		}
+	}
+	return strings.Join(parts, "/"), names
+}
+
+// OpenAPI describes every rule as an operation. Mock bodies become response
+// examples with schemas inferred from them. When several rules share a
+// method and path their responses are merged, the first one winning per
+// status code.
+func OpenAPI(conf *config.Config, title string) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: "1.0.0"},
+		Paths:   make(map[string]map[string]*Operation),
+	}
+
+	for _, rule := range conf.Rules {
+		if rule.Request == nil {
+			continue
+		}
+		path, params := paramsToTemplate(rule.Request.Path)
+		method := strings.ToLower(rule.Request.Method)
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		op := doc.Paths[path][method]
+		if op == nil {
+			op = &Operation{Responses: make(map[string]Response)}
+			for _, name := range params {
+				op.Parameters = append(op.Parameters, Parameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   &Schema{Type: "string"},
+				})
+			}
+			for _, name := range slices.Sorted(maps.Keys(rule.Request.Headers)) {
+				if param, ok := matcherParam(name, "header", rule.Request.Headers[name]); ok {
+					op.Parameters = append(op.Parameters, param)
+				}
+			}
+			for _, name := range slices.Sorted(maps.Keys(rule.Request.Query)) {
+				if param, ok := matcherParam(name, "query", rule.Request.Query[name]); ok {
+					op.Parameters = append(op.Parameters, param)
+				}
+			}
+			for _, name := range slices.Sorted(maps.Keys(rule.Request.Cookies)) {
+				if param, ok := matcherParam(name, "cookie", rule.Request.Cookies[name]); ok {
+					op.Parameters = append(op.Parameters, param)
+				}
+			}
+			doc.Paths[path][method] = op
+		}
+
+		switch {
+		case rule.IsMock():
+			status := rule.Response.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			code := strconv.Itoa(int(status))
+			if _, ok := op.Responses[code]; !ok {
+				op.Responses[code] = mockResponse(rule.Response, status)
+			}
+		case rule.IsProxy():
+			if op.Summary == "" {
+				op.Summary = "Proxied to " + rule.Proxy.Url
+			}
+			if _, ok := op.Responses["default"]; !ok {
+				op.Responses["default"] = Response{Description: "Upstream response"}
+			}
+		}
+	}
+
+	return doc
+}
+
+// matcherParam describes a header, query or cookie matcher as a required
+// parameter. Absent matchers have no parameter.
+func matcherParam(name, in string, m config.Matcher) (Parameter, bool) {
+	if m.Absent {
+		return Parameter{}, false
+	}
+	param := Parameter{
+		Name:     name,
+		In:       in,
+		Required: true,
+		Schema:   &Schema{Type: "string"},
+	}
+	if m.Equals != nil {
+		param.Example = *m.Equals
+	}
+	return param, true
+}
+
+func headerValue(headers map[string]any, name string) string {
+	for key, val := range headers {
+		if strings.EqualFold(key, name) {
+			return fmt.Sprint(val)
+		}
+	}
+	return ""
+}
+
+func mockResponse(res *config.MockResponse, status uint16) Response {
+	out := Response{Description: http.StatusText(int(status))}
+	if out.Description == "" {
+		out.Description = "Response"
+	}
+	ctype := headerValue(res.Headers, "Content-Type")
+
+	if res.BodyFile != "" {
+		if ctype == "" {
+			ctype = mime.TypeByExtension(filepath.Ext(res.BodyFile))
+		}
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		out.Content = map[string]MediaType{
+			ctype: {Schema: &Schema{Type: "string", Format: "binary"}},
+		}
+		return out
+	}
+
+	var example any
+	switch {
+	case res.Body.IsStructured():
+		example = res.Body.Data
+	case res.Body.Text == "":
+		return out
+	default:
+		var parsed any
+		if err := json.Unmarshal([]byte(res.Body.Text), &parsed); err == nil {
+			example = parsed
+			if ctype == "" {
+				ctype = "application/json"
+			}
+		} else {
+			example = res.Body.Text
+		}
+	}
+	if ctype == "" {
+		ctype = "text/plain"
+	}
+	// drop parameters such as charset
+	if mt, _, err := mime.ParseMediaType(ctype); err == nil {
+		ctype = mt
+	}
+
+	out.Content = map[string]MediaType{
+		ctype: {Schema: inferSchema(example), Example: example},
+	}
+	return out
+}
+
+// inferSchema describes a decoded JSON/YAML value. Lists use the schema of
+// their first item.
+func inferSchema(v any) *Schema {
+	switch val := v.(type) {
+	case map[string]any:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for k, item := range val {
+			s.Properties[k] = inferSchema(item)
+		}
+		return s
+	case []any:
+		s := &Schema{Type: "array", Items: &Schema{}}
+		if len(val) > 0 {
+			s.Items = inferSchema(val[0])
+		}
+		return s
+	case string:
+		return &Schema{Type: "string"}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case int, int64, uint64:
+		return &Schema{Type: "integer"}
+	case float64:
+		if val == math.Trunc(val) {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
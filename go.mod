@@ -3,6 +3,7 @@ module github.com/Cozzytree/apihub
 go 1.25.3
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/fsnotify/fsnotify v1.9.0
 	gopkg.in/yaml.v3 v3.0.1
 )
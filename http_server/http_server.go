@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,6 +19,7 @@ import (
 
 type route struct {
 	method  string
+	host    string
 	path    string
 	handler interfaces.HandlerFn
 }
@@ -27,15 +30,21 @@ type HttpServer struct {
 	Middlewares []interfaces.MiddlewareFn
 	server      *http.Server
 	serverCtx   context.Context
+	cancel      context.CancelFunc
 }
 
 func CreateHttpServer() *HttpServer {
-	return &HttpServer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HttpServer{
+		serverCtx: ctx,
+		cancel:    cancel,
+	}
 }
 
-func (h *HttpServer) AddRoute(method string, path string, handler interfaces.HandlerFn) {
+func (h *HttpServer) AddRoute(method string, host string, path string, handler interfaces.HandlerFn) {
 	h.Routes = append(h.Routes, route{
 		method:  method,
+		host:    host,
 		path:    path,
 		handler: handler,
 	})
@@ -46,7 +55,7 @@ func (h *HttpServer) AddMiddleware(middleware interfaces.MiddlewareFn) {
 }
 
 func (h *HttpServer) Stop() {
-	h.serverCtx.Done()
+	h.cancel()
 }
 
 func chainMiddlewares(h http.Handler, middlewares ...interfaces.MiddlewareFn) http.Handler {
@@ -69,6 +78,7 @@ func runServer(ctx context.Context, s *http.Server, shutdownTimeout time.Duratio
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
 
 	select {
 	case err := <-serverErrCh:
@@ -95,44 +105,113 @@ func runServer(ctx context.Context, s *http.Server, shutdownTimeout time.Duratio
 	return nil
 }
 
+// muxHost returns the host part of a ServeMux pattern for a host pattern.
+// ServeMux only knows exact hosts and ignores the request port, so
+// wildcards and hosts with a port are registered for every host and left
+// to the handler to match.
+func muxHost(host string) string {
+	if host == "" || strings.ContainsAny(host, "*:") {
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+// muxPaths turns a rule path into ServeMux path patterns. ServeMux has no
+// regex params, optional segments or catch-alls before the end, so params
+// become plain wildcards, an optional segment gives one pattern with and
+// one without it, and a catch-all ends the pattern with {rest...}. The
+// handler checks the real rule path.
+func muxPaths(path string) []string {
+	paths := []string{""}
+	for i, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		name, isParam := strings.CutPrefix(part, ":")
+		wildcard := fmt.Sprintf("/{p%d}", i)
+		switch {
+		case part == "**" || (isParam && strings.HasSuffix(name, "*")):
+			var out []string
+			for _, p := range paths {
+				// {rest...} matches /api/ but not /api
+				if p != "" {
+					out = append(out, p)
+				}
+				out = append(out, p+"/{rest...}")
+			}
+			return out
+		case isParam && strings.HasSuffix(name, "?"):
+			for _, p := range paths {
+				paths = append(paths, p+wildcard)
+			}
+		// ServeMux can't escape braces, so such segments match anything too
+		case isParam || part == "*" || strings.ContainsAny(part, "{}"):
+			for j := range paths {
+				paths[j] += wildcard
+			}
+		default:
+			for j := range paths {
+				paths[j] += "/" + part
+			}
+		}
+	}
+	for j := range paths {
+		if paths[j] == "" {
+			paths[j] = "/"
+		}
+	}
+	return paths
+}
+
+// handle registers pattern unless it already is. ServeMux panics on
+// patterns that overlap without one being more specific, those requests go
+// through a catch-all route for the method instead.
+func handle(mux *http.ServeMux, registered map[string]bool, method, pattern string, handler interfaces.HandlerFn) {
+	if registered[pattern] {
+		return
+	}
+	registered[pattern] = true
+	defer func() {
+		if err := recover(); err != nil {
+			fallback := method + " /{rest...}"
+			fmt.Printf("  %s overlaps another route, serving it through %s\n", pattern, fallback)
+			if !registered[fallback] {
+				registered[fallback] = true
+				mux.HandleFunc(fallback, handler)
+			}
+		}
+	}()
+	mux.HandleFunc(pattern, handler)
+	fmt.Println(" ", pattern)
+}
+
 func (h *HttpServer) Start(config interfaces.ServerConfig) error {
 	mux := &http.ServeMux{}
+	registered := make(map[string]bool)
 
 	fmt.Println("Routes:")
 	for _, r := range h.Routes {
-		var modifiedPath string
-		reqPath := strings.SplitSeq(r.path, "/")
-		for p := range reqPath {
-			if after, ok := strings.CutPrefix(p, ":"); ok {
-				modifiedPath += fmt.Sprintf("{%s}/", after)
-			} else {
-				modifiedPath += p + "/"
-			}
-		}
-
-		path := fmt.Sprintf("%s %s", r.method, modifiedPath)
-		if newPath, ok := strings.CutSuffix(path, "/"); ok {
-			mux.HandleFunc(newPath, r.handler)
-			fmt.Println(" ", newPath)
-		} else {
-			fmt.Println(" ", modifiedPath)
-			mux.HandleFunc(modifiedPath, r.handler)
+		for _, path := range muxPaths(r.path) {
+			pattern := fmt.Sprintf("%s %s%s", r.method, muxHost(r.host), path)
+			handle(mux, registered, r.method, pattern, r.handler)
 		}
 	}
 
-	handler := chainMiddlewares(mux, h.Middlewares...)
+	// ServeMux compares hosts as they are sent
+	hosts := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = strings.ToLower(r.Host)
+		mux.ServeHTTP(w, r)
+	})
+	handler := chainMiddlewares(hosts, h.Middlewares...)
 
 	s := &http.Server{
 		Handler:        handler,
-		Addr:           fmt.Sprintf(":%d", config.Port),
+		Addr:           net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
 		MaxHeaderBytes: int(config.Max_header_size),
 		ReadTimeout:    time.Duration(config.Request_timeout_ms) * time.Millisecond,
 		WriteTimeout:   time.Duration(config.Request_timeout_ms) * time.Millisecond,
 	}
 
-	if h.server == nil {
-		h.server = s
-		h.serverCtx = context.Background()
-	}
+	h.server = s
 	return runServer(h.serverCtx, s, 5*time.Second)
 }
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestMuxPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "/", want: []string{"/"}},
+		{path: "", want: []string{"/"}},
+		{path: "/users", want: []string{"/users"}},
+		{path: "/users/", want: []string{"/users"}},
+		{path: "/users/:id", want: []string{"/users/{p1}"}},
+		{path: `/users/:id(\d+)`, want: []string{"/users/{p1}"}},
+		{path: "/files/*/meta", want: []string{"/files/{p1}/meta"}},
+		{path: "/posts/:id?", want: []string{"/posts", "/posts/{p1}"}},
+		{path: "/a/:x?/:y?", want: []string{"/a", "/a/{p1}", "/a/{p2}", "/a/{p1}/{p2}"}},
+		{path: "/a/:x?/b", want: []string{"/a/b", "/a/{p1}/b"}},
+		{path: "/:x?", want: []string{"/", "/{p0}"}},
+		{path: "/api/**", want: []string{"/api", "/api/{rest...}"}},
+		{path: "/api/:rest*", want: []string{"/api", "/api/{rest...}"}},
+		{path: "/**", want: []string{"/{rest...}"}},
+		{path: "/api/**/edit", want: []string{"/api", "/api/{rest...}"}},
+		{path: "/a/:x?/**", want: []string{"/a", "/a/{rest...}", "/a/{p1}", "/a/{p1}/{rest...}"}},
+		{path: "/tpl/{name}", want: []string{"/tpl/{p1}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := muxPaths(tt.path); !slices.Equal(got, tt.want) {
+				t.Errorf("muxPaths(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMuxPathsRegister(t *testing.T) {
+	// every pattern must be accepted by ServeMux and route the requests
+	// the rule path matches to the handler
+	tests := []struct {
+		path     string
+		requests []string
+	}{
+		{path: "/posts/:id?", requests: []string{"/posts", "/posts/7"}},
+		{path: "/api/**/edit", requests: []string{"/api/edit", "/api/a/b/edit"}},
+		{path: "/a/:x?/**", requests: []string{"/a", "/a/b", "/a/b/c/d"}},
+		{path: "/files/:name", requests: []string{"/files/a%2Fb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mux := http.NewServeMux()
+			for _, p := range muxPaths(tt.path) {
+				mux.HandleFunc("GET "+p, func(w http.ResponseWriter, r *http.Request) {})
+			}
+			for _, target := range tt.requests {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("GET %s = %d, want 200", target, rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestMuxHost(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{host: "", want: ""},
+		{host: "API.Example.com", want: "api.example.com"},
+		{host: "*.example.com", want: ""},
+		{host: "example.com:8080", want: ""},
+	}
+	for _, tt := range tests {
+		if got := muxHost(tt.host); got != tt.want {
+			t.Errorf("muxHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
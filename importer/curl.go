@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+// shellWords splits a command line the way a POSIX shell would for the
+// quoting styles curl commands use.
+func shellWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	quote := rune(0)
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// a backslash-newline continues the line
+			if r != '\n' {
+				cur.WriteRune(r)
+				inWord = true
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// curlValueFlags take an argument that the importer doesn't use.
+var curlValueFlags = map[string]bool{
+	"-o":                true,
+	"--output":          true,
+	"-m":                true,
+	"--max-time":        true,
+	"--connect-timeout": true,
+	"-w":                true,
+	"--write-out":       true,
+	"-x":                true,
+	"--proxy":           true,
+	"--cacert":          true,
+	"--cert":            true,
+	"--key":             true,
+	"-c":                true,
+	"--cookie-jar":      true,
+	"--retry":           true,
+}
+
+// isShortValueFlag reports whether w is a one-letter flag that takes a
+// value, which curl also accepts attached, as in -XPOST.
+func isShortValueFlag(w string) bool {
+	return len(w) == 2 && (strings.Contains("XHduAbe", w[1:]) || curlValueFlags[w])
+}
+
+// Curl converts a curl command into a proxy rule that forwards the same
+// request path to the same upstream with the same headers.
+func Curl(command string) ([]config.Rule, error) {
+	words, err := shellWords(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 && words[0] == "curl" {
+		words = words[1:]
+	}
+
+	method := ""
+	rawURL := ""
+	hasData := false
+	headers := make(map[string]string)
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if len(w) > 2 && w[0] == '-' && w[1] != '-' && isShortValueFlag(w[:2]) {
+			words = slices.Insert(words, i+1, w[2:])
+			w = w[:2]
+		}
+		next := func() (string, error) {
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("%s requires a value", w)
+			}
+			i++
+			return words[i], nil
+		}
+
+		switch w {
+		case "-X", "--request":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			method = strings.ToUpper(v)
+		case "-H", "--header":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			name, value, ok := strings.Cut(v, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid header %q", v)
+			}
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-urlencode", "--json":
+			if _, err := next(); err != nil {
+				return nil, err
+			}
+			hasData = true
+			if w == "--json" {
+				headers["Content-Type"] = "application/json"
+			}
+		case "-u", "--user":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(v))
+		case "-A", "--user-agent":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			headers["User-Agent"] = v
+		case "-b", "--cookie":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			headers["Cookie"] = v
+		case "-e", "--referer":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			headers["Referer"] = v
+		case "-I", "--head":
+			method = http.MethodHead
+		case "--url":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			rawURL = v
+		default:
+			if curlValueFlags[w] {
+				i++
+				continue
+			}
+			if !strings.HasPrefix(w, "-") {
+				rawURL = w
+			}
+		}
+	}
+
+	if rawURL == "" {
+		return nil, errors.New("no URL in curl command")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", rawURL, err)
+	}
+
+	if method == "" {
+		method = http.MethodGet
+		if hasData {
+			method = http.MethodPost
+		}
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	// the query of each request is forwarded, so the url leaves it out
+	u.RawQuery = ""
+	u.Fragment = ""
+	proxy := &config.ProxyConfig{Url: u.String()}
+	if len(headers) > 0 {
+		proxy.Headers = headers
+	}
+	return []config.Rule{{
+		Request: &config.RequestRule{Path: path, Method: method},
+		Proxy:   proxy,
+	}}, nil
+}
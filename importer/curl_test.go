@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestCurl(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		method  string
+		path    string
+		url     string
+		headers map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "get",
+			command: "curl https://api.example.com/items",
+			method:  "GET", path: "/items", url: "https://api.example.com/items",
+		},
+		{
+			name:    "separate flags",
+			command: "curl -X POST -H 'Accept: application/json' https://api.example.com/items",
+			method:  "POST", path: "/items", url: "https://api.example.com/items",
+			headers: map[string]string{"Accept": "application/json"},
+		},
+		{
+			name:    "attached flags",
+			command: `curl -XPUT -H'Accept: text/plain' -HX-Id:1 https://api.example.com/items/1`,
+			method:  "PUT", path: "/items/1", url: "https://api.example.com/items/1",
+			headers: map[string]string{"Accept": "text/plain", "X-Id": "1"},
+		},
+		{
+			name:    "attached data",
+			command: "curl -d@body.json https://api.example.com/items",
+			method:  "POST", path: "/items", url: "https://api.example.com/items",
+		},
+		{
+			name:    "attached ignored value",
+			command: "curl -o/dev/null -m5 https://api.example.com/items",
+			method:  "GET", path: "/items", url: "https://api.example.com/items",
+		},
+		{
+			name:    "query left out of the url",
+			command: "curl 'https://api.example.com/search?q=a&page=2#top'",
+			method:  "GET", path: "/search", url: "https://api.example.com/search",
+		},
+		{
+			name:    "head",
+			command: "curl -I example.com",
+			method:  "HEAD", path: "/", url: "http://example.com",
+		},
+		{name: "no url", command: "curl -XPOST", wantErr: true},
+		{name: "missing value", command: "curl https://x -H", wantErr: true},
+		{name: "unterminated quote", command: "curl 'https://x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Curl(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Curl(%q) = nil error, want one", tt.command)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Curl(%q): %v", tt.command, err)
+			}
+			r := rules[0]
+			if r.Request.Method != tt.method || r.Request.Path != tt.path {
+				t.Errorf("request = %s %s, want %s %s", r.Request.Method, r.Request.Path, tt.method, tt.path)
+			}
+			if r.Proxy.Url != tt.url {
+				t.Errorf("proxy url = %q, want %q", r.Proxy.Url, tt.url)
+			}
+			if !maps.Equal(r.Proxy.Headers, tt.headers) {
+				t.Errorf("headers = %v, want %v", r.Proxy.Headers, tt.headers)
+			}
+		})
+	}
+}
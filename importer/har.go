@@ -0,0 +1,231 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int         `json:"status"`
+		Headers []harHeader `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harDocument struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type HAROptions struct {
+	// Group keeps only the last response for each method and path. Without
+	// it entries that differ in their query string get query matchers and
+	// repeated requests keep their first response.
+	Group bool
+	// StripHeaders drops volatile response headers such as Date and Set-Cookie.
+	StripHeaders bool
+	// Generalize turns numeric path segments into :params.
+	Generalize bool
+}
+
+// volatileHeaders change on every response or only make sense for the
+// original connection.
+var volatileHeaders = []string{
+	"Date",
+	"Set-Cookie",
+	"Expires",
+	"Last-Modified",
+	"Etag",
+	"Age",
+	"Connection",
+	"Keep-Alive",
+}
+
+// framingHeaders describe how the captured body went over the wire.
+// Importers keep the decoded body, so these never fit the mock and are
+// always dropped.
+var framingHeaders = []string{
+	"Content-Encoding",
+	"Content-Length",
+	"Transfer-Encoding",
+}
+
+func isFramingHeader(name string) bool {
+	return slices.Contains(framingHeaders, http.CanonicalHeaderKey(name))
+}
+
+// HAR converts the entries of a HAR capture into mock rules, in capture
+// order. Every method and path, or with query matchers method, path and
+// query, is imported once, so the rules pass validation.
+func HAR(path string, opts HAROptions) ([]config.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc harDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+
+	var rules []config.Rule
+	var queries []url.Values
+	seen := make(map[string]int)
+	// distinct query strings sent to each method and path
+	variants := make(map[string]map[string]bool)
+
+	for i, entry := range doc.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: invalid url %q: %v", path, i, entry.Request.URL, err)
+		}
+
+		reqPath := u.Path
+		if reqPath == "" {
+			reqPath = "/"
+		}
+		if opts.Generalize {
+			reqPath = generalizePath(reqPath)
+		}
+
+		rule, err := harRule(entry, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %v", path, i, err)
+		}
+		rule.Request = &config.RequestRule{
+			Path:   reqPath,
+			Method: strings.ToUpper(entry.Request.Method),
+		}
+
+		key := rule.Request.Method + " " + reqPath
+		query := u.Query()
+		if !opts.Group {
+			if variants[key] == nil {
+				variants[key] = make(map[string]bool)
+			}
+			variants[key][query.Encode()] = true
+			key += "?" + query.Encode()
+		}
+		if idx, ok := seen[key]; ok {
+			if opts.Group {
+				rules[idx] = rule
+			}
+			continue
+		}
+		seen[key] = len(rules)
+		rules = append(rules, rule)
+		queries = append(queries, query)
+	}
+
+	// query matchers are only added where the path alone can't tell
+	// entries apart
+	for i := range rules {
+		req := rules[i].Request
+		if len(variants[req.Method+" "+req.Path]) > 1 {
+			req.Query = queryMatchers(queries[i])
+		}
+	}
+	return rules, nil
+}
+
+// queryMatchers matches exactly the values of query.
+func queryMatchers(query url.Values) map[string]config.Matcher {
+	if len(query) == 0 {
+		return nil
+	}
+	matchers := make(map[string]config.Matcher, len(query))
+	for name, values := range query {
+		if len(values) == 1 {
+			matchers[name] = config.Exact(values[0])
+		} else {
+			matchers[name] = config.Matcher{All: values}
+		}
+	}
+	return matchers
+}
+
+func harRule(entry harEntry, opts HAROptions) (config.Rule, error) {
+	res := &config.MockResponse{Status: uint16(entry.Response.Status)}
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+
+	for _, h := range entry.Response.Headers {
+		name := http.CanonicalHeaderKey(h.Name)
+		// HTTP/2 pseudo headers show up in some captures
+		if strings.HasPrefix(name, ":") {
+			continue
+		}
+		if isFramingHeader(name) || opts.StripHeaders && slices.Contains(volatileHeaders, name) {
+			continue
+		}
+		if res.Headers == nil {
+			res.Headers = make(map[string]any)
+		}
+		res.Headers[name] = h.Value
+	}
+
+	content := entry.Response.Content
+	if content.Encoding == "base64" {
+		body, err := base64.StdEncoding.DecodeString(content.Text)
+		if err != nil {
+			return config.Rule{}, fmt.Errorf("invalid base64 body: %v", err)
+		}
+		res.Body = config.Body{Text: string(body)}
+	} else {
+		res.Body = config.Body{Text: content.Text}
+	}
+
+	if content.MimeType != "" {
+		if res.Headers == nil {
+			res.Headers = make(map[string]any)
+		}
+		if _, ok := res.Headers["Content-Type"]; !ok {
+			res.Headers["Content-Type"] = content.MimeType
+		}
+	}
+
+	return config.Rule{Response: res}, nil
+}
+
+// generalizePath replaces numeric segments with :id, :id2, ...
+func generalizePath(path string) string {
+	parts := strings.Split(path, "/")
+	n := 0
+	for i, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			continue
+		}
+		n++
+		if n == 1 {
+			parts[i] = ":id"
+		} else {
+			parts[i] = ":id" + strconv.Itoa(n)
+		}
+	}
+	return strings.Join(parts, "/")
+}
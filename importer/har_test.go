@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+const testHAR = `{"log": {"entries": [
+	{"request": {"method": "GET", "url": "http://x/api/items?page=1"},
+	 "response": {"status": 200, "content": {"mimeType": "application/json", "text": "[1]"}}},
+	{"request": {"method": "GET", "url": "http://x/api/items?page=2"},
+	 "response": {"status": 200, "content": {"mimeType": "application/json", "text": "[2]"}}},
+	{"request": {"method": "GET", "url": "http://x/api/items?page=2"},
+	 "response": {"status": 200, "content": {"mimeType": "application/json", "text": "[2, again]"}}},
+	{"request": {"method": "GET", "url": "http://x/api/items"},
+	 "response": {"status": 200, "content": {"mimeType": "application/json", "text": "[]"}}},
+	{"request": {"method": "GET", "url": "http://x/api/tags?a=1&a=2"},
+	 "response": {"status": 200, "content": {"text": "tags"}}},
+	{"request": {"method": "GET", "url": "http://x/api/users/1"},
+	 "response": {"status": 200, "headers": [{"name": "content-encoding", "value": "gzip"}, {"name": "Date", "value": "now"}],
+	  "content": {"text": "one"}}},
+	{"request": {"method": "GET", "url": "http://x/api/users/2"},
+	 "response": {"status": 200, "content": {"text": "two"}}}
+]}}`
+
+func TestHAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := os.WriteFile(path, []byte(testHAR), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  HAROptions
+		rules int
+		// queries maps a rule's body to the query matchers it must have
+		queries map[string]map[string]string
+	}{
+		{
+			name:  "default",
+			rules: 6,
+			queries: map[string]map[string]string{
+				"[1]": {"page": "1"},
+				"[2]": {"page": "2"},
+				"[]":  nil,
+				"one": nil,
+			},
+		},
+		{name: "group", opts: HAROptions{Group: true}, rules: 4},
+		{name: "generalize", opts: HAROptions{Generalize: true}, rules: 5},
+		{name: "group and generalize", opts: HAROptions{Group: true, Generalize: true}, rules: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := HAR(path, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(rules), tt.rules)
+			}
+			for _, r := range rules {
+				want, ok := tt.queries[r.Response.Body.Text]
+				if !ok {
+					continue
+				}
+				if len(r.Request.Query) != len(want) {
+					t.Errorf("%s: query = %v, want %v", r.Response.Body.Text, r.Request.Query, want)
+				}
+				for name, value := range want {
+					if m := r.Request.Query[name]; m.Equals == nil || *m.Equals != value {
+						t.Errorf("%s: query %s = %+v, want %s", r.Response.Body.Text, name, m, value)
+					}
+				}
+				if _, ok := r.Response.Headers["Content-Encoding"]; ok {
+					t.Errorf("%s: Content-Encoding was imported", r.Response.Body.Text)
+				}
+			}
+
+			conf, err := config.FromRules(path, rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range conf.Validate() {
+				t.Errorf("validation: %v", e)
+			}
+		})
+	}
+}
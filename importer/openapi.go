@@ -0,0 +1,328 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Cozzytree/apihub/config"
+	"gopkg.in/yaml.v3"
+)
+
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       any                       `yaml:"type"`
+	Format     string                    `yaml:"format"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	AllOf      []*openAPISchema          `yaml:"allOf"`
+	OneOf      []*openAPISchema          `yaml:"oneOf"`
+	AnyOf      []*openAPISchema          `yaml:"anyOf"`
+	Enum       []any                     `yaml:"enum"`
+	Example    any                       `yaml:"example"`
+	Examples   []any                     `yaml:"examples"`
+	Default    any                       `yaml:"default"`
+}
+
+type openAPIExample struct {
+	Ref   string `yaml:"$ref"`
+	Value any    `yaml:"value"`
+}
+
+type openAPIMediaType struct {
+	Schema   *openAPISchema             `yaml:"schema"`
+	Example  any                        `yaml:"example"`
+	Examples map[string]*openAPIExample `yaml:"examples"`
+}
+
+type openAPIResponse struct {
+	Ref     string                      `yaml:"$ref"`
+	Content map[string]openAPIMediaType `yaml:"content"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `yaml:"operationId"`
+	Tags        []string                    `yaml:"tags"`
+	Responses   map[string]*openAPIResponse `yaml:"responses"`
+}
+
+type openAPIPathItem struct {
+	Get     *openAPIOperation `yaml:"get"`
+	Put     *openAPIOperation `yaml:"put"`
+	Post    *openAPIOperation `yaml:"post"`
+	Delete  *openAPIOperation `yaml:"delete"`
+	Options *openAPIOperation `yaml:"options"`
+	Head    *openAPIOperation `yaml:"head"`
+	Patch   *openAPIOperation `yaml:"patch"`
+	Trace   *openAPIOperation `yaml:"trace"`
+}
+
+type openAPIMethodOp struct {
+	method string
+	op     *openAPIOperation
+}
+
+func (p *openAPIPathItem) operations() []openAPIMethodOp {
+	all := []openAPIMethodOp{
+		{http.MethodGet, p.Get},
+		{http.MethodPost, p.Post},
+		{http.MethodPut, p.Put},
+		{http.MethodPatch, p.Patch},
+		{http.MethodDelete, p.Delete},
+		{http.MethodHead, p.Head},
+		{http.MethodOptions, p.Options},
+		{http.MethodTrace, p.Trace},
+	}
+	return slices.DeleteFunc(all, func(o openAPIMethodOp) bool {
+		return o.op == nil
+	})
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                      `yaml:"openapi"`
+	Paths      map[string]*openAPIPathItem `yaml:"paths"`
+	Components struct {
+		Schemas   map[string]*openAPISchema   `yaml:"schemas"`
+		Responses map[string]*openAPIResponse `yaml:"responses"`
+		Examples  map[string]*openAPIExample  `yaml:"examples"`
+	} `yaml:"components"`
+}
+
+// OpenAPI converts every operation of an OpenAPI 3 document into a mock
+// rule. JSON specs are read with the YAML parser since JSON is valid YAML.
+func OpenAPI(path string) ([]config.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%s: unsupported openapi version %q, only 3.x is supported", path, doc.OpenAPI)
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	var rules []config.Rule
+	for _, p := range paths {
+		for _, o := range doc.Paths[p].operations() {
+			rules = append(rules, config.Rule{
+				Name: o.op.OperationID,
+				Tags: o.op.Tags,
+				Request: &config.RequestRule{
+					Path:   templateToParams(p),
+					Method: o.method,
+				},
+				Response: doc.mockResponse(o.op),
+			})
+		}
+	}
+	return rules, nil
+}
+
+// templateToParams turns /users/{id} into /users/:id.
+func templateToParams(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			parts[i] = ":" + part[1:len(part)-1]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// pickStatus prefers the lowest 2xx response, then default, then anything.
+func pickStatus(responses map[string]*openAPIResponse) (string, uint16) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			return code, statusCode(code)
+		}
+	}
+	if _, ok := responses["default"]; ok {
+		return "default", http.StatusOK
+	}
+	if len(codes) > 0 {
+		return codes[0], statusCode(codes[0])
+	}
+	return "", http.StatusOK
+}
+
+func statusCode(code string) uint16 {
+	// ranges like 2XX become their first code
+	code = strings.NewReplacer("X", "0", "x", "0").Replace(code)
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 100 || n > 599 {
+		return http.StatusOK
+	}
+	return uint16(n)
+}
+
+func (d *openAPIDocument) mockResponse(op *openAPIOperation) *config.MockResponse {
+	code, status := pickStatus(op.Responses)
+	res := &config.MockResponse{Status: status}
+
+	response := op.Responses[code]
+	if response != nil && response.Ref != "" {
+		response = d.Components.Responses[refName(response.Ref)]
+	}
+	if response == nil || len(response.Content) == 0 {
+		return res
+	}
+
+	ctype := "application/json"
+	media, ok := response.Content[ctype]
+	if !ok {
+		types := make([]string, 0, len(response.Content))
+		for t := range response.Content {
+			types = append(types, t)
+		}
+		slices.Sort(types)
+		ctype = types[0]
+		media = response.Content[ctype]
+	}
+
+	res.Headers = map[string]any{"content-type": ctype}
+	body := d.exampleFor(media)
+	if s, ok := body.(string); ok {
+		res.Body = config.Body{Text: s}
+	} else if body != nil {
+		res.Body = config.Body{Data: body}
+	}
+	return res
+}
+
+func (d *openAPIDocument) exampleFor(media openAPIMediaType) any {
+	if media.Example != nil {
+		return media.Example
+	}
+	if len(media.Examples) > 0 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		ex := media.Examples[names[0]]
+		if ex != nil && ex.Ref != "" {
+			ex = d.Components.Examples[refName(ex.Ref)]
+		}
+		if ex != nil {
+			return ex.Value
+		}
+	}
+	if media.Schema != nil {
+		return d.sample(media.Schema, 0)
+	}
+	return nil
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func (s *openAPISchema) typeName() string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []any:
+		// OpenAPI 3.1 allows a list of types, pick the first non-null one
+		for _, name := range t {
+			if name != "null" {
+				return fmt.Sprint(name)
+			}
+		}
+	}
+	if len(s.Properties) > 0 {
+		return "object"
+	}
+	if s.Items != nil {
+		return "array"
+	}
+	return ""
+}
+
+// sample builds a value that satisfies the schema, preferring examples the
+// spec already provides.
+func (d *openAPIDocument) sample(s *openAPISchema, depth int) any {
+	if s == nil || depth > 8 {
+		return nil
+	}
+	if s.Ref != "" {
+		return d.sample(d.Components.Schemas[refName(s.Ref)], depth+1)
+	}
+	switch {
+	case s.Example != nil:
+		return s.Example
+	case len(s.Examples) > 0:
+		return s.Examples[0]
+	case s.Default != nil:
+		return s.Default
+	case len(s.Enum) > 0:
+		return s.Enum[0]
+	}
+
+	if len(s.AllOf) > 0 {
+		merged := map[string]any{}
+		for _, sub := range s.AllOf {
+			if m, ok := d.sample(sub, depth+1).(map[string]any); ok {
+				for k, v := range m {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	if len(s.OneOf) > 0 {
+		return d.sample(s.OneOf[0], depth+1)
+	}
+	if len(s.AnyOf) > 0 {
+		return d.sample(s.AnyOf[0], depth+1)
+	}
+
+	switch s.typeName() {
+	case "object":
+		obj := map[string]any{}
+		for name, prop := range s.Properties {
+			obj[name] = d.sample(prop, depth+1)
+		}
+		return obj
+	case "array":
+		return []any{d.sample(s.Items, depth+1)}
+	case "integer":
+		return 0
+	case "number":
+		return 0.0
+	case "boolean":
+		return true
+	case "string":
+		switch s.Format {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "date":
+			return "2024-01-01"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "email":
+			return "user@example.com"
+		case "uri", "url":
+			return "https://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
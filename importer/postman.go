@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/Cozzytree/apihub/config"
+)
+
+type postmanHeader struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+// postmanURL is either a raw string or an object with a raw field.
+type postmanURL struct {
+	Raw string `json:"raw"`
+}
+
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &u.Raw)
+	}
+	type plain postmanURL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanHeader `json:"header"`
+	URL    postmanURL      `json:"url"`
+}
+
+type postmanResponse struct {
+	Name            string          `json:"name"`
+	OriginalRequest *postmanRequest `json:"originalRequest"`
+	Code            int             `json:"code"`
+	Header          []postmanHeader `json:"header"`
+	Body            string          `json:"body"`
+}
+
+type postmanItem struct {
+	Name     string            `json:"name"`
+	Item     []postmanItem     `json:"item"`
+	Request  *postmanRequest   `json:"request"`
+	Response []postmanResponse `json:"response"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type postmanCollection struct {
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+var postmanVarRe = regexp.MustCompile(`\{\{\s*([^}]+?)\s*\}\}`)
+
+// envName turns a Postman variable like baseUrl into BASE_URL.
+func envName(name string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range name {
+		switch {
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			r = '_'
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+type postmanImporter struct {
+	vars  map[string]string
+	rules []config.Rule
+	seen  map[string]bool
+}
+
+// placeholders replaces {{var}} with ${VAR} or ${VAR:-value} when the
+// collection defines a value.
+func (p *postmanImporter) placeholders(s string) string {
+	return postmanVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := postmanVarRe.FindStringSubmatch(m)[1]
+		if val, ok := p.vars[name]; ok && val != "" {
+			return "${" + envName(name) + ":-" + val + "}"
+		}
+		return "${" + envName(name) + "}"
+	})
+}
+
+// splitURL separates the origin from the path of a raw request URL. Path
+// segments that are variables become :params.
+func (p *postmanImporter) splitURL(raw string) (origin, path string) {
+	raw, _, _ = strings.Cut(raw, "#")
+	raw, _, _ = strings.Cut(raw, "?")
+
+	rest := raw
+	scheme := ""
+	if before, after, ok := strings.Cut(raw, "://"); ok {
+		scheme, rest = before+"://", after
+	}
+	host, path, _ := strings.Cut(rest, "/")
+	path = "/" + path
+
+	if scheme == "" && !postmanVarRe.MatchString(host) {
+		scheme = "https://"
+	}
+	origin = p.placeholders(scheme + host)
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if m := postmanVarRe.FindStringSubmatch(part); m != nil && m[0] == part {
+			parts[i] = ":" + m[1]
+		}
+	}
+	return origin, strings.Join(parts, "/")
+}
+
+func (p *postmanImporter) add(rule config.Rule) {
+	key := rule.Request.Method + " " + rule.Request.Path
+	if p.seen[key] {
+		return
+	}
+	p.seen[key] = true
+	p.rules = append(p.rules, rule)
+}
+
+func (p *postmanImporter) walk(items []postmanItem) {
+	for _, item := range items {
+		if len(item.Item) > 0 {
+			p.walk(item.Item)
+		}
+		if item.Request == nil {
+			continue
+		}
+
+		method := strings.ToUpper(item.Request.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		if len(item.Response) == 0 {
+			origin, path := p.splitURL(item.Request.URL.Raw)
+			proxy := &config.ProxyConfig{Url: origin + path}
+			for _, h := range item.Request.Header {
+				if h.Disabled {
+					continue
+				}
+				if proxy.Headers == nil {
+					proxy.Headers = make(map[string]string)
+				}
+				proxy.Headers[h.Key] = p.placeholders(h.Value)
+			}
+			p.add(config.Rule{
+				Request: &config.RequestRule{Path: path, Method: method},
+				Proxy:   proxy,
+			})
+			continue
+		}
+
+		for _, example := range item.Response {
+			req := item.Request
+			if example.OriginalRequest != nil && example.OriginalRequest.URL.Raw != "" {
+				req = example.OriginalRequest
+			}
+			_, path := p.splitURL(req.URL.Raw)
+
+			res := &config.MockResponse{
+				Status: uint16(example.Code),
+				Body:   config.Body{Text: example.Body},
+			}
+			if res.Status == 0 {
+				res.Status = http.StatusOK
+			}
+			for _, h := range example.Header {
+				if h.Disabled || isFramingHeader(h.Key) {
+					continue
+				}
+				if res.Headers == nil {
+					res.Headers = make(map[string]any)
+				}
+				res.Headers[h.Key] = h.Value
+			}
+			p.add(config.Rule{
+				Request:  &config.RequestRule{Path: path, Method: method},
+				Response: res,
+			})
+		}
+	}
+}
+
+// Postman converts a Postman v2 collection into rules. Requests with saved
+// example responses become mock rules, bare requests become proxy rules.
+// Only the first rule for each method and path is kept.
+func Postman(path string) ([]config.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+
+	p := &postmanImporter{
+		vars: make(map[string]string),
+		seen: make(map[string]bool),
+	}
+	for _, v := range collection.Variable {
+		if v.Value != nil {
+			p.vars[v.Key] = fmt.Sprint(v.Value)
+		}
+	}
+	p.walk(collection.Item)
+
+	return p.rules, nil
+}
@@ -23,6 +23,8 @@ type MiddlewareFn func(next http.Handler) http.Handler
 type Server interface {
 	Start(config ServerConfig) error
 	Stop()
-	AddRoute(method string, path string, handler HandlerFn)
+	// AddRoute registers handler for method and path. host is a host
+	// pattern such as api.local or *.local, empty for any host.
+	AddRoute(method string, host string, path string, handler HandlerFn)
 	AddMiddleware(middleware MiddlewareFn)
 }
@@ -88,36 +88,42 @@ func getClientIP(r *http.Request) string {
 	return host
 }
 
-func (rl *RateLimiter) RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := r.Header.Get("Origin")
-		if key == "" {
-			key = getClientIP(r)
-		}
-		now := time.Now()
-		rl.mu.Lock()
-
-		c, ok := rl.clients[key]
-		if !ok || now.Sub(c.lastRequest) > rl.Window {
-			rl.clients[key] = &client{
-				count:       1,
-				lastRequest: now,
-			}
-			rl.mu.Unlock()
-			next.ServeHTTP(w, r)
-			return
+// Allow counts a request against its client and reports whether it is
+// within the limit.
+func (rl *RateLimiter) Allow(r *http.Request) bool {
+	key := r.Header.Get("Origin")
+	if key == "" {
+		key = getClientIP(r)
+	}
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	c, ok := rl.clients[key]
+	if !ok || now.Sub(c.lastRequest) > rl.Window {
+		rl.clients[key] = &client{
+			count:       1,
+			lastRequest: now,
 		}
+		return true
+	}
+
+	if c.count >= rl.Limit {
+		return false
+	}
+
+	c.count++
+	c.lastRequest = now
+	return true
+}
 
-		if c.count >= rl.Limit {
-			rl.mu.Unlock()
+// RateLimitMiddleware rejects requests over the limit with a 429.
+func (rl *RateLimiter) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rl.Allow(r) {
 			http.Error(w, "429 - Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
-
-		c.count++
-		c.lastRequest = now
-		rl.mu.Unlock()
-
 		next.ServeHTTP(w, r)
 	})
 }